@@ -1,6 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
@@ -8,6 +16,8 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"encoding/json"
 	"regexp"
+	"sort"
+	"time"
 )
 var logger = shim.NewLogger("CLDChaincode")
 //==============================================================================================================================
@@ -23,6 +33,13 @@ const   TRADER          =  "trader"
 const   CUTTER          =  "cutter"
 const   JEWELLERYMAKER	=  "jewellery_maker"
 const   CUSTOMER        =  "customer"
+const   INSPECTOR       =  "inspector"
+const   SCRAP_MERCHANT  =  "scrap_merchant"
+
+var known_roles = map[string]bool{
+	MINER: true, DISTRIBUTOR: true, DEALERSHIP: true, BUYER: true, TRADER: true, CUTTER: true,
+	JEWELLERYMAKER: true, CUSTOMER: true, INSPECTOR: true, SCRAP_MERCHANT: true,
+}
 
 
 //==============================================================================================================================
@@ -37,7 +54,223 @@ const   STATE_TRADING           =  4
 const   STATE_CUTTING           =  5
 const   STATE_JEWEL_MAKING      =  6
 const   STATE_PURCHASING        =  7
-         
+const   STATE_BEING_SCRAPPED    =  8
+
+var status_labels = map[int]string{
+	STATE_MINING:          "mining",
+	STATE_DISTRIBUTING:    "distributing",
+	STATE_INTER_DEALING:   "inter_dealing",
+	STATE_BUYING:          "buying",
+	STATE_TRADING:         "trading",
+	STATE_CUTTING:         "cutting",
+	STATE_JEWEL_MAKING:    "jewel_making",
+	STATE_PURCHASING:      "purchasing",
+	STATE_BEING_SCRAPPED:  "being_scrapped",
+}
+
+
+//==============================================================================================================================
+//	 Payment statuses - How much of the sale price has been paid, for diamonds sold on installments. A diamond with no
+//						payment status is treated as unpaid.
+//==============================================================================================================================
+const   PAYMENT_UNPAID          =  "unpaid"
+const   PAYMENT_PARTIAL         =  "partial"
+const   PAYMENT_PAID            =  "paid"
+
+
+//==============================================================================================================================
+//	 Configuration defaults - Used unless MINER has overridden them on the ledger with set_config
+//==============================================================================================================================
+const   ASSET_ID_PATTERN        =  "^[A-Za-z]{2}[0-9]{7}$"			// Two letters followed by seven digits
+const   MAX_BATCH               =  100							// Most assetIDs accepted by a single batch function
+const   MAX_ASSETS              =  100000						// Most diamonds the asset index can hold
+const   CREATE_LIMIT            =  1000							// Most diamonds one miner can create in a single create window
+const   CREATE_WINDOW           =  3600							// Length of the create window in seconds
+const   MAX_SNAPSHOT            =  1000							// Most diamonds export_snapshot will return in one response
+const   MAX_IMAGE_HASHES        =  10							// Most photos that can be attached to a diamond
+const   PASSPORT_VERSION        =  1								// Bumped whenever the Diamond_Passport layout changes
+const   SCHEMA_VERSION          =  2								// Layout of the diamond records written by this chaincode
+const   MIN_SCHEMA_VERSION      =  1								// Oldest record layout that can still be read and upgraded
+const   QR_VERIFY_URL_TEMPLATE  =  "/verify/{assetID}?h={hash}"		// Filled in by the client with the values from the QR payload
+const   JSONLD_VOCAB            =  "urn:diamond:"					// Vocabulary the terms of export_jsonld documents expand to
+
+
+//==============================================================================================================================
+//	 Ledger key prefixes - Keys for the lookup records kept alongside the diamonds
+//==============================================================================================================================
+const   GIA_INDEX_PREFIX        =  "gia_"							// GIA certificate number -> assetID
+const   DIAMONDAT_INDEX_PREFIX  =  "diamondat_"					// Diamondat -> assetID
+const   JEWELLERY_PREFIX        =  "jewellery_"					// Jewellery ID -> Jewellery_Item
+const   CREATE_COUNT_PREFIX     =  "create_count_"				// Miner and create window -> diamonds created
+const   OWNER_INDEX_PREFIX      =  "owner_"						// Owner and assetID -> assetID, see owner_index_key
+
+
+//==============================================================================================================================
+//	 Transfer edges - Each transfer a diamond can make along the supply chain. The named transfer functions are all
+//					  driven from this table, so a change to the chain only needs a change here.
+//==============================================================================================================================
+type Transfer_Edge struct {
+	From           string
+	To             string
+	RequiredStatus int
+	NextStatus     int
+	RequiredFields []string
+	RequiresPaid   bool
+	RequiresKPCert bool											// Diamonds with a recorded origin need a Kimberley Process certificate
+}
+
+var transfer_edges = map[string]Transfer_Edge{
+	"miner_to_distributor":         {From: MINER,          To: DISTRIBUTOR,    RequiredStatus: STATE_MINING,        NextStatus: STATE_DISTRIBUTING},
+	"distributor_to_dealership":    {From: DISTRIBUTOR,    To: DEALERSHIP,     RequiredStatus: STATE_DISTRIBUTING,  NextStatus: STATE_INTER_DEALING, RequiresKPCert: true},
+	"dealership_to_buyer":          {From: DEALERSHIP,     To: BUYER,          RequiredStatus: STATE_INTER_DEALING, NextStatus: STATE_BUYING},
+	"buyer_to_trader":              {From: BUYER,          To: TRADER,         RequiredStatus: STATE_BUYING,        NextStatus: STATE_TRADING},
+	"trader_to_cutter":             {From: TRADER,         To: CUTTER,         RequiredStatus: STATE_TRADING,       NextStatus: STATE_CUTTING},
+	"cutter_to_jewellery_maker":    {From: CUTTER,         To: JEWELLERYMAKER, RequiredStatus: STATE_CUTTING,       NextStatus: STATE_JEWEL_MAKING, RequiredFields: []string{"cut", "symmetry", "polish"}},
+	"jewellery_maker_to_customer":  {From: JEWELLERYMAKER, To: CUSTOMER,       RequiredStatus: STATE_JEWEL_MAKING,  NextStatus: STATE_PURCHASING,   RequiredFields: []string{"jewellerytype"}, RequiresPaid: true},
+}
+
+
+//==============================================================================================================================
+//	 Grade vocabularies - The default sets of grades accepted by the update functions. MINER can replace any of these on the
+//						  ledger with set_grade_vocabulary, the defaults are only used until that has been done
+//==============================================================================================================================
+const   GRADE_VOCABULARY_PREFIX  =  "grade_vocabulary_"
+
+var default_grade_vocabularies = map[string][]string{
+	"clarity":  {"FL", "IF", "VVS1", "VVS2", "VS1", "VS2", "SI1", "SI2", "I1", "I2", "I3"},
+	"cut":      {"Excellent", "Very Good", "Good", "Fair", "Poor"},
+	"colour":   {"D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z"},
+	"polish":   {"Excellent", "Very Good", "Good", "Fair", "Poor"},
+	"symmetry": {"Excellent", "Very Good", "Good", "Fair", "Poor"},
+	"fluorescence": {"None", "Faint", "Medium", "Strong", "Very Strong"},
+}
+
+  
+//==============================================================================================================================
+//	 Function registry - Every function the router accepts along with a one line description. Invoke and Query reject any
+//						 function not listed here, so a new function has to be added here before it can be called.
+//==============================================================================================================================
+var invoke_functions = map[string]string{
+	"create_asset":                 "Creates a new diamond owned by the calling miner",
+	"mint_diamond":                 "Creates a new diamond with an assetID generated from the transaction",
+	"ping":                         "Checks the chaincode is responding",
+	"batch_update_grade":           "Sets the same grade on a list of diamonds",
+	"import_asset_ids":             "Merges assetIDs from a previous chaincode into the index",
+	"set_config":                   "Overrides configuration values",
+	"set_grade_vocabulary":         "Replaces the allowed grades for a grading field",
+	"miner_to_distributor":         "Transfers a diamond from the miner to a distributor",
+	"distributor_to_dealership":    "Transfers a diamond from a distributor to a dealership",
+	"dealership_to_buyer":          "Transfers a diamond from a dealership to a buyer",
+	"buyer_to_trader":              "Transfers a diamond from a buyer to a trader",
+	"trader_to_cutter":             "Transfers a diamond from a trader to a cutter",
+	"cutter_to_jewellery_maker":    "Transfers a diamond from a cutter to a jewellery maker",
+	"jewellery_maker_to_customer":  "Transfers a diamond from a jewellery maker to a customer",
+	"distribute_and_transfer":      "Grades a diamond and transfers it to a dealership in one invoke",
+	"transfer_with_document":       "Transfers a diamond recording the hash of its paperwork",
+	"transfer":                     "Transfers a diamond along a named edge of the supply chain",
+	"set_metadata":                 "Sets a free form key/value pair on a diamond",
+	"add_image_hash":               "Attaches the SHA-256 hash of a photo to a diamond",
+	"add_label":                    "Tags one of the caller`s diamonds with a label",
+	"set_kp_cert":                  "Records the Kimberley Process certificate of a rough diamond",
+	"remove_label":                 "Removes a label from one of the caller`s diamonds",
+	"set_custodian":                "Sets who has physical custody of a diamond",
+	"transfer_custody":             "Hands physical custody of a diamond to someone else and records it, ownership is unchanged",
+	"set_archived":                 "Archives or unarchives a diamond",
+	"set_held":                     "Places or lifts a hold on a diamond",
+	"set_disputed":                 "Marks a diamond as disputed or resolves the dispute",
+	"record_price":                 "Records a sale price or valuation against a diamond",
+	"update_colour":                "Sets the colour grade of a diamond",
+	"update_cut":                   "Sets the cut grade of a diamond",
+	"update_clarity":               "Sets the clarity grade of a diamond",
+	"update_symmetry":              "Sets the symmetry grade of a diamond",
+	"update_polish":                "Sets the polish grade of a diamond",
+	"update_fluorescence":          "Sets the fluorescence grade of a diamond",
+	"update_diamondat":             "Sets the Diamondat identifier of a diamond",
+	"update_date":                  "Sets the date of a diamond",
+	"update_timestamp":             "Sets the timestamp of a diamond",
+	"update_jewellerytype":         "Sets the jewellery type of a diamond",
+	"update_gia_cert":              "Sets the GIA certificate number of a diamond",
+	"admin_transfer":               "Reassigns a diamond to any participant outside the normal transfers, such as on a court order",
+	"reissue_gia_cert":             "Replaces the GIA certificate number of a diamond after GIA reissues the report",
+	"update_origin":                "Sets the mine of origin of a diamond",
+	"update_location":              "Sets where a diamond currently is",
+	"update_carat":                 "Sets the carat weight of a diamond while it is being mined",
+	"record_repolish":              "Records the lower carat weight of a diamond after it is re-polished",
+	"update_payment_status":        "Sets whether a diamond is unpaid, partly paid or paid for",
+	"scrap_asset":                  "Marks a diamond as scrapped",
+	"import_snapshot":              "Restores diamonds and the asset index from a snapshot",
+	"create_jewellery":             "Sets a number of diamonds into a single piece of jewellery",
+	"set_global_freeze":            "Pauses or resumes transfers and updates across the network",
+	"set_qr_signing_key":           "Sets the key QR payloads are signed with",
+	"batch_assign_diamondat":       "Assigns Diamondats to a parcel of diamonds at once",
+	"bulk_scrap":                   "Scraps a list of diamonds at once, for example in a recall",
+	"scrap_jewellery":              "Scraps a piece of jewellery and every diamond set in it",
+	"batch_transfer":               "Transfers a list of the caller`s diamonds to one recipient",
+	"link_rough":                   "Links a polished diamond to the rough it was cut from",
+	"revoke_user":                  "Adds a user to the revoked set",
+	"reinstate_user":               "Removes a user from the revoked set",
+	"verify_user":                  "Marks a user`s identity as verified",
+	"rebuild_owner_index":          "Rebuilds the owner index from the owner on every diamond",
+	"unverify_user":                "Removes the verified mark from a user",
+	"transfer_to_verified":         "Transfers a diamond only if the recipient has been verified",
+	"customer_write_off":           "Requests that a customer`s diamond is written off and scrapped",
+	"approve_write_off":            "Approves a pending write off, scrapping the diamond",
+	"record_inspection":            "Records a physical inspection and compares it to the grades on record",
+}
+
+var query_functions = map[string]string{
+	"get_asset_details":            "Returns a single diamond",
+	"check_unique_assetID":         "Checks an assetID has not been used",
+	"get_assets":                   "Returns every diamond the caller can see, optionally including archived and held ones and gzip compressed",
+	"get_ecert":                    "Returns the stored ecert of a user",
+	"get_grade_vocabulary":         "Returns the allowed grades for a grading field",
+	"ping":                         "Checks the chaincode is responding",
+	"get_config":                   "Returns the configuration in use",
+	"get_diamonds_grouped":         "Returns the diamonds the caller can see grouped by status",
+	"get_transfer_stats":           "Returns how many diamonds a participant has sent and received",
+	"list_functions":               "Returns every invoke and query function with a description",
+	"get_total_transfers":          "Returns the number of transfers made across the network",
+	"get_diamonds_by_owner_statuses": "Returns an owner`s diamonds that are in any of the statuses listed",
+	"get_diamonds_by_owners":       "Returns the diamonds held by any of the owners listed",
+	"refresh_role":                 "Rereads a user`s role from their stored ecert",
+	"get_incomplete_provenance":    "Returns the diamonds with missing or broken provenance",
+	"get_orphaned_ownership":       "Returns the diamonds owned by revoked users",
+	"get_stale_diamonds":           "Returns the diamonds that haven`t been updated for a number of days",
+	"get_value_trend":              "Returns the price history of a diamond with the change between prices",
+	"get_diamonds_paged":           "Returns a page of the diamonds the caller can see, starting after a bookmark",
+	"whoami":                       "Returns the username, affiliation and certificate issuer of the caller",
+	"get_rough_link":               "Returns the rough or polished diamond linked to a diamond",
+	"compare_diamonds":             "Returns the fields on which two diamonds differ",
+	"get_grade_distribution":       "Returns how many diamonds hold each clarity, colour and cut grade",
+	"get_parcel_summary":           "Returns the total carats of a parcel and its carat weighted colour and clarity mix",
+	"get_diamond_qr_payload":       "Returns a compact signed payload for a diamond`s QR code",
+	"verify_qr_payload":            "Checks a scanned QR payload was signed by this chaincode and still matches the diamond",
+	"get_diamonds_by_location":     "Returns the diamonds the caller can see at a location",
+	"get_diamonds_by_creator_and_status": "Returns the diamonds a participant created that are now in a status",
+	"export_snapshot":              "Returns the asset index and every diamond record as a backup",
+	"export_attestation":           "Returns an attestation of a diamond record for use off the ledger",
+	"export_jsonld":                "Returns a diamond and its ownership and grading history as a JSON-LD document",
+	"verify_attestation":           "Checks an attestation still matches the diamond on the ledger",
+	"verify_attestations_batch":    "Checks a list of attestations against the ledger",
+	"get_jewellery_components":     "Returns a piece of jewellery with the diamonds set in it",
+	"get_status_history":           "Returns every status change a diamond has been through",
+	"get_provenance_score":         "Returns a 0 to 100 score of how well documented a diamond is with a breakdown",
+	"get_unidentified_diamonds":    "Returns the diamonds the caller can see that haven`t been given a Diamondat",
+	"get_transferable_to":          "Returns the caller`s diamonds that can be transferred to a role right now",
+	"get_diamonds_by_label":        "Returns the caller`s diamonds tagged with a label",
+	"get_diamonds_in_jewel_stage":  "Returns the caller`s diamonds that are being made into jewellery",
+	"get_historical_holdings":      "Returns every diamond a participant has owned with the dates they held it",
+	"get_activity_summary":         "Returns counts of creations, transfers, scraps and grading changes between two times",
+	"get_creation_counts_by_day":   "Returns how many diamonds were created on each day between two dates",
+	"get_active_holders":           "Returns each participant currently holding diamonds with how many they hold",
+	"get_post_cert_grade_changes":  "Returns the diamonds whose grades were changed after they were certified",
+	"get_schema_version":           "Returns the diamond record layouts the chaincode writes and can read",
+	"get_global_freeze":            "Returns whether transfers and updates are frozen and why",
+	"get_most_transferred":         "Returns the diamonds that have changed hands the most",
+	"detect_ownership_anomalies":   "Returns repeated owners and impossible role sequences in a diamond`s ownership history",
+	"get_diamond_passport":         "Returns the details, certification, provenance and inspections of a diamond in one document",
+}
+
   
 //==============================================================================================================================
 //	 Structure Definitions 
@@ -56,17 +289,334 @@ type  SimpleChaincode struct {
 type Asset struct {
 	AssetID      string      `json:"assetID"`
 	Colour          string   `json:"colour"`
-	Diamondat           int      `json:"diamondat"`
+	Diamondat           string      `json:"diamondat"`
 	Cut             string   `json:"cut"`					
 	Clarity         string   `json:"clarity"`
 	Location        string   `json:"location"`
+	Origin          string   `json:"origin"`
 	Date            string      `json:"date"`
 	Timestamp           string	`json:"timestamp"`
 	Polish          string   `json:"polish"`
 	Symmetry        string   `json:"symmetry"`
+	Fluorescence    string   `json:"fluorescence"`
+	GIACert         string   `json:"giaCert"`
     JewelleryType  string   `json:"jewellerytype"`
 	Owner           string 		`json:"owner"`
     Status          int      `json:"status"`
+	Scrapped        bool     `json:"scrapped"`
+	OwnershipHistory []Ownership_Record `json:"ownershipHistory"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	WriteOffPending bool     `json:"writeOffPending"`
+	WriteOffReason  string   `json:"writeOffReason,omitempty"`
+	ScrapReason     string   `json:"scrapReason,omitempty"`
+	InspectionHistory []Inspection_Record `json:"inspectionHistory"`
+	LastUpdated     string   `json:"lastUpdated"`
+	ImageHashes     []string `json:"imageHashes"`
+	Custodian       string   `json:"custodian"`
+	Archived        bool     `json:"archived"`
+	Held            bool     `json:"held"`
+	Disputed        bool     `json:"disputed"`
+	PaymentStatus   string   `json:"paymentStatus"`
+	SchemaVersion   int      `json:"schemaVersion"`
+	GradingHistory  []Grade_Change `json:"gradingHistory"`
+	ScrappedAt      string   `json:"scrappedAt,omitempty"`
+	Carat           float64  `json:"carat"`
+	Creator         string   `json:"creator"`
+	CreatedAt       string   `json:"createdAt"`
+	Labels          []string `json:"labels"`
+	KPCertNumber    string   `json:"kpCertNumber,omitempty"`
+	DestructionCertHash string `json:"destructionCertHash,omitempty"`
+	GIACertAt       string   `json:"giaCertAt,omitempty"`				// When the diamond was first certified, reissues leave it unchanged
+	StatusHistory   []Status_Change `json:"statusHistory"`
+	JewelleryID     string   `json:"jewelleryID,omitempty"`
+	RepolishHistory []Repolish_Record `json:"repolishHistory"`
+	PriceHistory    []Price_Record `json:"priceHistory"`
+	RoughAssetID    string   `json:"roughAssetID,omitempty"`
+	PolishedAssetID string   `json:"polishedAssetID,omitempty"`
+	CustodyHistory  []Custody_Record `json:"custodyHistory"`
+	GIAReissues     []GIA_Reissue_Record `json:"giaReissues"`
+}
+
+//==============================================================================================================================
+//	Ownership_Record - A single change of ownership. From is empty for the entry written when the diamond is created.
+//					   AuthorizedBy and Reason are only set on transfers the Miner made with admin_transfer.
+//==============================================================================================================================
+
+type Ownership_Record struct {
+	From         string `json:"from"`
+	Owner        string `json:"owner"`
+	Affiliation  string `json:"affiliation"`
+	Timestamp    string `json:"timestamp"`
+	DocumentHash string `json:"documentHash,omitempty"`
+	AuthorizedBy string `json:"authorizedBy,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+//==============================================================================================================================
+//	Inspection_Record - A physical inspection of a diamond. Mismatches lists the fields where the inspected grade differs
+//						from the grade on record at the time of the inspection.
+//==============================================================================================================================
+
+type Inspection_Record struct {
+	Inspector  string            `json:"inspector"`
+	Timestamp  string            `json:"timestamp"`
+	Grades     map[string]string `json:"grades"`
+	Mismatches []string          `json:"mismatches"`
+	Match      bool              `json:"match"`
+}
+
+//==============================================================================================================================
+//	Custody_Record - A change of who physically holds a diamond. Ownership is unaffected.
+//==============================================================================================================================
+
+type Custody_Record struct {
+	From      string `json:"from"`
+	Custodian string `json:"custodian"`
+	ChangedBy string `json:"changedBy"`
+	Timestamp string `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	GIA_Reissue_Record - A GIA certificate number replaced because GIA reissued the report.
+//==============================================================================================================================
+
+type GIA_Reissue_Record struct {
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Reason     string `json:"reason"`
+	ReissuedBy string `json:"reissuedBy"`
+	Timestamp  string `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	Parcel_Summary - The total weight of a parcel and the share of that weight held by each colour and clarity grade,
+//					 returned by get_parcel_summary.
+//==============================================================================================================================
+
+type Parcel_Summary struct {
+	Diamonds    int                `json:"diamonds"`
+	TotalCarats float64            `json:"totalCarats"`
+	Colour      map[string]float64 `json:"colour"`
+	Clarity     map[string]float64 `json:"clarity"`
+}
+
+//==============================================================================================================================
+//	Post_Cert_Changes - The grade changes made to a diamond after it was certified, returned by get_post_cert_grade_changes.
+//==============================================================================================================================
+
+type Post_Cert_Changes struct {
+	AssetID     string         `json:"assetID"`
+	GIACert     string         `json:"giaCert"`
+	CertifiedAt string         `json:"certifiedAt"`
+	Changes     []Grade_Change `json:"changes"`
+}
+
+//==============================================================================================================================
+//	Field_Difference - A field on which two diamonds compared by compare_diamonds differ, with each diamond`s value.
+//==============================================================================================================================
+
+type Field_Difference struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+type Diamond_Comparison struct {
+	AssetA      string             `json:"assetA"`
+	AssetB      string             `json:"assetB"`
+	Identical   bool               `json:"identical"`
+	Differences []Field_Difference `json:"differences"`
+}
+
+//==============================================================================================================================
+//	Grade_Change - A change to one of the diamond`s grades. Old is the grade before the change.
+//==============================================================================================================================
+
+type Grade_Change struct {
+	Field     string `json:"field"`
+	Old       string `json:"old"`
+	New       string `json:"new"`
+	ChangedBy string `json:"changedBy"`
+	Timestamp string `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	Snapshot - A backup of the asset index and every diamond record, returned by export_snapshot.
+//==============================================================================================================================
+
+type Snapshot struct {
+	AssetIDs []string `json:"assetIDs"`
+	Diamonds []Asset  `json:"diamonds"`
+}
+
+//==============================================================================================================================
+//	Attestation - A snapshot of a diamond record exported for use off the ledger. Hash is the SHA-256 of the whole record
+//				  when it was exported, so any later change to the diamond makes the attestation stale.
+//==============================================================================================================================
+
+type Attestation struct {
+	AssetID   string `json:"assetID"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	JSONLD_Diamond - A diamond and its ownership and grading history as a JSON-LD document, returned by export_jsonld. The
+//					 proof is the diamond`s attestation hash, so it can be checked with verify_attestation.
+//==============================================================================================================================
+
+type JSONLD_Diamond struct {
+	Context          map[string]string  `json:"@context"`
+	ID               string             `json:"@id"`
+	Type             string             `json:"@type"`
+	Carat            float64            `json:"carat"`
+	Colour           string             `json:"colour"`
+	Cut              string             `json:"cut"`
+	Clarity          string             `json:"clarity"`
+	Polish           string             `json:"polish"`
+	Symmetry         string             `json:"symmetry"`
+	Fluorescence     string             `json:"fluorescence"`
+	Origin           string             `json:"origin"`
+	GIACert          string             `json:"giaCert"`
+	Diamondat        string             `json:"diamondat"`
+	Status           string             `json:"status"`
+	Owner            string             `json:"owner"`
+	OwnershipHistory []Ownership_Record `json:"ownershipHistory"`
+	GradingHistory   []Grade_Change     `json:"gradingHistory"`
+	Proof            JSONLD_Proof       `json:"proof"`
+}
+
+type JSONLD_Proof struct {
+	Type    string `json:"@type"`
+	Digest  string `json:"digest"`
+	Created string `json:"created"`
+}
+
+//==============================================================================================================================
+//	Attestation_Result - Whether an attestation still matches the diamond on the ledger.
+//==============================================================================================================================
+
+type Attestation_Result struct {
+	AssetID string `json:"assetID"`
+	Match   bool   `json:"match"`
+	Error   string `json:"error,omitempty"`
+}
+
+//==============================================================================================================================
+//	Jewellery_Item - A piece of jewellery made from one or more diamonds. Each component diamond points back to the item
+//					 through its JewelleryID.
+//==============================================================================================================================
+
+type Jewellery_Item struct {
+	JewelleryID string   `json:"jewelleryID"`
+	Maker       string   `json:"maker"`
+	Components  []string `json:"components"`
+	Timestamp   string   `json:"timestamp"`
+	Scrapped    bool     `json:"scrapped"`
+	ScrappedBy  string   `json:"scrappedBy,omitempty"`
+}
+
+//==============================================================================================================================
+//	Status_Change - A move of the diamond from one lifecycle status to another. From is empty for the entry written when
+//					the diamond is created.
+//==============================================================================================================================
+
+type Status_Change struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	ChangedBy string `json:"changedBy"`
+	Timestamp string `json:"timestamp"`
+	CertHash  string `json:"certHash,omitempty"`						// Destruction certificate, on the change into being_scrapped only
+}
+
+//==============================================================================================================================
+//	Repolish_Record - Weight lost when a diamond was re-polished.
+//==============================================================================================================================
+
+type Repolish_Record struct {
+	OldCarat   float64 `json:"oldCarat"`
+	NewCarat   float64 `json:"newCarat"`
+	Reason     string  `json:"reason"`
+	RecordedBy string  `json:"recordedBy"`
+	Timestamp  string  `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	Provenance_Score - How well documented a diamond is, out of 100, returned by get_provenance_score. Each factor is worth
+//					   an equal share and Factors shows which were met.
+//==============================================================================================================================
+
+type Provenance_Score struct {
+	AssetID string         `json:"assetID"`
+	Score   int            `json:"score"`
+	Factors []Score_Factor `json:"factors"`
+}
+
+type Score_Factor struct {
+	Name   string `json:"name"`
+	Met    bool   `json:"met"`
+	Points int    `json:"points"`
+}
+
+//==============================================================================================================================
+//	Activity_Summary - Counts of what happened across the network between Start and End, returned by get_activity_summary.
+//==============================================================================================================================
+
+type Activity_Summary struct {
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	Creations      int    `json:"creations"`
+	Transfers      int    `json:"transfers"`
+	Scraps         int    `json:"scraps"`
+	GradingChanges int    `json:"gradingChanges"`
+}
+
+//==============================================================================================================================
+//	Price_Record - A price recorded against a diamond, typically at a sale or valuation.
+//==============================================================================================================================
+
+type Price_Record struct {
+	Price     float64 `json:"price"`
+	RecordedBy string `json:"recordedBy"`
+	Timestamp string  `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	Value_Trend - The price history of a diamond with the change from each price to the next, returned by get_value_trend.
+//				  PercentChange is the change from the first price to the last.
+//==============================================================================================================================
+
+type Value_Trend struct {
+	AssetID       string        `json:"assetID"`
+	Points        []Trend_Point `json:"points"`
+	PercentChange float64       `json:"percentChange"`
+}
+
+type Trend_Point struct {
+	Price     float64 `json:"price"`
+	Delta     float64 `json:"delta"`
+	Timestamp string  `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	Holding_Period - A period during which a participant owned a diamond, returned by get_historical_holdings. Until is
+//					 empty if they still own it.
+//==============================================================================================================================
+
+type Holding_Period struct {
+	AssetID string `json:"assetID"`
+	Since   string `json:"since"`
+	Until   string `json:"until"`
+}
+
+//==============================================================================================================================
+//	Transfer_Stats - Counts of the diamonds a participant has sent and received, returned by get_transfer_stats.
+//==============================================================================================================================
+
+type Transfer_Stats struct {
+	Owner    string `json:"owner"`
+	Sent     int    `json:"sent"`
+	Received int    `json:"received"`
 }
 
 
@@ -79,15 +629,177 @@ type AssetID_Holder struct {
 	AssetIDs []string `json:"assetIDs"`
 }
 
+//==============================================================================================================================
+//	Revoked_Holder - Holds the names of users whose identities have been revoked.
+//==============================================================================================================================
+
+type Revoked_Holder struct {
+	Users []string `json:"users"`
+}
+
+//==============================================================================================================================
+//	Verified_Holder - Holds the names of users whose identity the Miner has verified.
+//==============================================================================================================================
+
+type Verified_Holder struct {
+	Users []string `json:"users"`
+}
+
 //==============================================================================================================================
 //	User_and_eCert - Struct for storing the JSON of a user and their ecert
 //==============================================================================================================================
 
 type User_and_eCert struct {
 	Identity string `json:"identity"`
-	eCert string `json:"ecert"`
+	ECert string `json:"ecert"`
 }		
 
+//==============================================================================================================================
+//	Batch_Result - The outcome for a single assetID in a batch operation. Batches report per asset rather than failing
+//				   as a whole so the caller can retry just the ones that did not go through.
+//==============================================================================================================================
+
+type Batch_Result struct {
+	AssetID string `json:"assetID"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+//==============================================================================================================================
+//	 Error codes - HTTP like codes returned to clients in the error JSON so they can tell why a call failed without
+//				   matching on the message text
+//==============================================================================================================================
+const   ERR_VALIDATION          =  400
+const   ERR_PERMISSION          =  403
+const   ERR_NOT_FOUND           =  404
+const   ERR_INTERNAL            =  500
+
+//==============================================================================================================================
+//	Coded_Error - The JSON returned as the error message from Invoke and Query.
+//==============================================================================================================================
+
+type Coded_Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+//==============================================================================================================================
+//	Chaincode_Config - The configuration values in use. Stored on the ledger under "config" once MINER overrides any of them.
+//==============================================================================================================================
+
+type Chaincode_Config struct {
+	AssetIDPattern string `json:"assetIDPattern"`
+	MaxBatch       int    `json:"maxBatch"`
+	MaxAssets      int    `json:"maxAssets"`
+	CreateLimit    int    `json:"createLimit"`
+	CreateWindow   int    `json:"createWindow"`
+}
+
+//==============================================================================================================================
+//	Provenance_Report - The provenance problems found with a single diamond, returned by get_incomplete_provenance.
+//==============================================================================================================================
+
+type Provenance_Report struct {
+	AssetID  string   `json:"assetID"`
+	Problems []string `json:"problems"`
+}
+
+//==============================================================================================================================
+//	Freeze_State - Whether transfers and updates are paused across the network, stored under the "global_freeze" key.
+//==============================================================================================================================
+
+type Freeze_State struct {
+	Frozen    bool   `json:"frozen"`
+	Reason    string `json:"reason"`
+	SetBy     string `json:"setBy"`
+	Timestamp string `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	Schema_Info - The diamond record layouts this chaincode writes and can read, returned by get_schema_version.
+//==============================================================================================================================
+
+type Schema_Info struct {
+	SchemaVersion    int `json:"schemaVersion"`
+	MinSchemaVersion int `json:"minSchemaVersion"`
+}
+
+//==============================================================================================================================
+//	Caller_Identity - The identity of the caller, returned by whoami. Fabric 0.6 has no MSP, so the issuer of the caller`s
+//					  certificate stands in for the MSP ID and is left out when the certificate can`t be read.
+//==============================================================================================================================
+
+type Caller_Identity struct {
+	Username    string `json:"username"`
+	Affiliation string `json:"affiliation"`
+	Issuer      string `json:"issuer,omitempty"`
+}
+
+//==============================================================================================================================
+//	Diamond_Passport - Everything about a diamond in one document, returned by get_diamond_passport. The layout is fixed
+//					   for a given PassportVersion so clients can render it reliably.
+//==============================================================================================================================
+
+type Diamond_Passport struct {
+	PassportVersion int                 `json:"passportVersion"`
+	AssetID         string              `json:"assetID"`
+	Details         Passport_Details    `json:"details"`
+	Certification   Passport_Cert       `json:"certification"`
+	Provenance      []Ownership_Record  `json:"provenance"`
+	Inspections     []Inspection_Record `json:"inspections"`
+}
+
+type Passport_Details struct {
+	Diamondat     string `json:"diamondat"`
+	Colour        string `json:"colour"`
+	Cut           string `json:"cut"`
+	Clarity       string `json:"clarity"`
+	Polish        string `json:"polish"`
+	Symmetry      string `json:"symmetry"`
+	Fluorescence  string `json:"fluorescence"`
+	Origin        string `json:"origin"`
+	JewelleryType string `json:"jewellerytype"`
+	Status        string `json:"status"`
+}
+
+type Passport_Cert struct {
+	GIACert     string   `json:"giaCert"`
+	KPCert      string   `json:"kpCert,omitempty"`
+	ImageHashes []string `json:"imageHashes"`
+}
+
+//==============================================================================================================================
+//	QR_Payload - The compact record encoded in a diamond`s QR code. Field names are kept short to keep the code small.
+//				 Digest is a short SHA-256 of the public details so a scanned code can be checked against the ledger.
+//				 Signature is a short HMAC of the other fields under the key set with set_qr_signing_key.
+//==============================================================================================================================
+
+type QR_Payload struct {
+	AssetID   string `json:"id"`
+	URL       string `json:"u"`
+	Digest    string `json:"d"`
+	Signature string `json:"s"`
+}
+
+//==============================================================================================================================
+//	Diamond_Page - A page of diamonds returned by get_diamonds_paged. Bookmark is passed back to fetch the next page and is
+//				   empty once there are no more diamonds.
+//==============================================================================================================================
+
+type Diamond_Page struct {
+	Diamonds []Asset `json:"diamonds"`
+	Bookmark string  `json:"bookmark"`
+}
+
+//==============================================================================================================================
+//	Function_List - The invoke and query function registries as returned by list_functions.
+//==============================================================================================================================
+
+type Function_List struct {
+	Invoke map[string]string `json:"invoke"`
+	Query  map[string]string `json:"query"`
+}
+
 //==============================================================================================================================
 //	Init Function - Called when the user deploys the chaincode																	
 //==============================================================================================================================
@@ -117,7 +829,8 @@ func (t *SimpleChaincode) Init(stub  shim.ChaincodeStubInterface, function strin
 //	 General Functions
 //==============================================================================================================================
 //	 get_ecert - Takes the name passed and calls out to the REST API for HyperLedger to retrieve the ecert
-//				 for that user. Returns the ecert as retrived including html encoding.
+//				 for that user. Returns the ecert as retrived including html encoding. Ecerts share the key space with
+//				 every other record, so anything stored under the name that isn`t a certificate is treated as missing.
 //==============================================================================================================================
 func (t *SimpleChaincode) get_ecert(stub  shim.ChaincodeStubInterface, name string) ([]byte, error) {
 	
@@ -125,19 +838,30 @@ func (t *SimpleChaincode) get_ecert(stub  shim.ChaincodeStubInterface, name stri
 
 	if err != nil { return nil, errors.New("Couldn`t retrieve ecert for user " + name) }
 	
+	if block, _ := pem.Decode(ecert); block == nil || block.Type != "CERTIFICATE" { return nil, nil }
+	
 	return ecert, nil
 }
 
 //==============================================================================================================================
-//	 add_ecert - Adds a new ecert and user pair to the table of ecerts
+//	 add_ecert - Adds a new ecert and user pair to the table of ecerts. The ecert must be a PEM encoded x509 certificate.
 //==============================================================================================================================
 
 func (t *SimpleChaincode) add_ecert(stub  shim.ChaincodeStubInterface, name string, ecert string) ([]byte, error) {
 	
+	block, _ := pem.Decode([]byte(ecert))
 	
-	err := stub.PutState(name, []byte(ecert))
+	if block == nil { return nil, invalid_error("Invalid eCert for user " + name + ": not PEM encoded") }
+	
+	if block.Type != "CERTIFICATE" { return nil, invalid_error("Invalid eCert for user " + name + ": PEM block is " + block.Type + " not CERTIFICATE") }
+	
+	_, err := x509.ParseCertificate(block.Bytes)
+	
+	if err != nil { return nil, invalid_error("Invalid eCert for user " + name + ": " + err.Error()) }
+	
+	err = stub.PutState(name, []byte(ecert))
 
-	if err == nil {
+	if err != nil {
 		return nil, errors.New("Error storing eCert for user " + name + " identity: " + ecert)
 	}
 	
@@ -145,42 +869,218 @@ func (t *SimpleChaincode) add_ecert(stub  shim.ChaincodeStubInterface, name stri
 
 }
 //==============================================================================================================================
-//	 get_caller - Retrieves the username of the user who invoked the chaincode.
-//				  Returns the username as a string.
+//	 role_from_ecert - Parses a PEM ecert and returns the role it carries. The role is held as the organizational unit of
+//					   the certificate subject.
 //==============================================================================================================================
+func (t *SimpleChaincode) role_from_ecert(name string, ecert []byte) (string, error) {
 
-func (t *SimpleChaincode) get_username(stub shim.ChaincodeStubInterface) (string, error) {
+	block, _ := pem.Decode(ecert)
 
-    username, err := stub.ReadCertAttribute("username");
-	if err != nil { return "", errors.New("Couldn`t get attribute `username`. Error: " + err.Error()) }
-	return string(username), nil
-}
+	if block == nil || block.Type != "CERTIFICATE" { return "", errors.New("Stored eCert for user " + name + " is not a PEM certificate") }
 
-//==============================================================================================================================
-//	 check_affiliation - Takes an ecert as a string, decodes it to remove html encoding then parses it and checks the
-// 				  		certificates common name. The affiliation is stored as part of the common name.
-//==============================================================================================================================
-func (t *SimpleChaincode) check_affiliation(stub shim.ChaincodeStubInterface) (string, error) {
-    affiliation, err := stub.ReadCertAttribute("role");
-	if err != nil { return "", errors.New("Couldn't get attribute 'role'. Error: " + err.Error()) }
-	return string(affiliation), nil
+	cert, err := x509.ParseCertificate(block.Bytes)
 
-}
+	if err != nil { return "", errors.New("Stored eCert for user " + name + " couldn`t be parsed: " + err.Error()) }
+
+	if len(cert.Subject.OrganizationalUnit) == 0 { return "", errors.New("Stored eCert for user " + name + " has no role") }
 
+	return strings.ToLower(cert.Subject.OrganizationalUnit[0]), nil
+}
 
 //==============================================================================================================================
-//	 get_caller_data - Calls the get_ecert and check_role functions and returns the ecert and role for the
-//					 name passed.
+//	 caller_issuer - Returns the common name of the CA that issued the caller`s certificate, empty if the certificate
+//					 can`t be read. The certificate may come PEM encoded or as raw DER.
 //==============================================================================================================================
-func (t *SimpleChaincode) get_caller_data(stub  shim.ChaincodeStubInterface) (string, string, error){	
+func caller_issuer(stub  shim.ChaincodeStubInterface) string {
 
-	user, err := t.get_username(stub)
+	raw, err := stub.GetCallerCertificate()
 
+	if err != nil || len(raw) == 0 { return "" }
 
-	affiliation, err := t.check_affiliation(stub);			
-																		if err != nil { return "", "", err }
+	if block, _ := pem.Decode(raw); block != nil { raw = block.Bytes }
 
-	return user, affiliation, nil
+	cert, err := x509.ParseCertificate(raw)
+
+	if err != nil { return "" }
+
+	return cert.Issuer.CommonName
+}
+
+//==============================================================================================================================
+//	 refresh_role - Rereads the stored ecert of the user passed and returns the role it carries now. The role isn`t
+//					cached, so an updated ecert is reflected straight away. Only the Miner can read roles.
+//==============================================================================================================================
+func (t *SimpleChaincode) refresh_role(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, name string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission denied. refresh_role") }
+
+	ecert, err := t.get_ecert(stub, name)
+
+	if err != nil { return nil, err }
+
+	if ecert == nil { return nil, not_found_error("eCert not found for user " + name) }
+
+	role, err := t.role_from_ecert(name, ecert)
+
+	if err != nil { return nil, err }
+
+	return []byte(role), nil
+}
+
+//==============================================================================================================================
+//	 retrieve_revoked - Reads the set of revoked users, keyed by name for lookups.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_revoked(stub  shim.ChaincodeStubInterface) (map[string]bool, error) {
+
+	revoked := make(map[string]bool)
+
+	bytes, err := stub.GetState("revoked_users")
+
+	if err != nil { return nil, errors.New("Unable to get revoked users") }
+
+	if bytes == nil { return revoked, nil }
+
+	var holder Revoked_Holder
+
+	err = json.Unmarshal(bytes, &holder)
+
+	if err != nil { return nil, errors.New("Corrupt Revoked_Holder record") }
+
+	for _, user := range holder.Users { revoked[user] = true }
+
+	return revoked, nil
+}
+
+//==============================================================================================================================
+//	 set_revoked - Adds the user passed to the revoked set, or removes them when revoked is false. Only the Miner can
+//				   revoke or reinstate users.
+//==============================================================================================================================
+func (t *SimpleChaincode) set_revoked(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, name string, revoked bool) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission denied. set_revoked") }
+
+	if strings.TrimSpace(name) == "" { return nil, invalid_error("Invalid user name, cannot be empty") }
+
+	users, err := t.retrieve_revoked(stub)
+
+	if err != nil { return nil, err }
+
+	if revoked { users[name] = true } else { delete(users, name) }
+
+	var holder Revoked_Holder
+
+	for user := range users { holder.Users = append(holder.Users, user) }
+
+	sort.Strings(holder.Users)
+
+	bytes, err := json.Marshal(holder)
+
+	if err != nil { return nil, errors.New("Error creating Revoked_Holder record") }
+
+	err = stub.PutState("revoked_users", bytes)
+
+	if err != nil { return nil, errors.New("Error storing revoked users") }
+
+	return nil, nil
+}
+
+//==============================================================================================================================
+//	 retrieve_verified - Reads the set of verified users, keyed by name for lookups.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_verified(stub  shim.ChaincodeStubInterface) (map[string]bool, error) {
+
+	verified := make(map[string]bool)
+
+	bytes, err := stub.GetState("verified_users")
+
+	if err != nil { return nil, errors.New("Unable to get verified users") }
+
+	if bytes == nil { return verified, nil }
+
+	var holder Verified_Holder
+
+	err = json.Unmarshal(bytes, &holder)
+
+	if err != nil { return nil, errors.New("Corrupt Verified_Holder record") }
+
+	for _, user := range holder.Users { verified[user] = true }
+
+	return verified, nil
+}
+
+//==============================================================================================================================
+//	 set_verified - Marks the user passed as verified, or clears the mark when verified is false. Only the Miner can
+//					verify users.
+//==============================================================================================================================
+func (t *SimpleChaincode) set_verified(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, name string, verified bool) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission denied. set_verified") }
+
+	if strings.TrimSpace(name) == "" { return nil, invalid_error("Invalid user name, cannot be empty") }
+
+	users, err := t.retrieve_verified(stub)
+
+	if err != nil { return nil, err }
+
+	if verified { users[name] = true } else { delete(users, name) }
+
+	var holder Verified_Holder
+
+	for user := range users { holder.Users = append(holder.Users, user) }
+
+	sort.Strings(holder.Users)
+
+	bytes, err := json.Marshal(holder)
+
+	if err != nil { return nil, errors.New("Error creating Verified_Holder record") }
+
+	err = stub.PutState("verified_users", bytes)
+
+	if err != nil { return nil, errors.New("Error storing verified users") }
+
+	return nil, nil
+}
+
+//==============================================================================================================================
+//	 get_caller - Retrieves the username of the user who invoked the chaincode.
+//				  Returns the username as a string.
+//==============================================================================================================================
+
+func (t *SimpleChaincode) get_username(stub shim.ChaincodeStubInterface) (string, error) {
+
+    username, err := stub.ReadCertAttribute("username");
+	if err != nil { return "", errors.New("Couldn`t get attribute `username`. Error: " + err.Error()) }
+	return string(username), nil
+}
+
+//==============================================================================================================================
+//	 check_affiliation - Takes an ecert as a string, decodes it to remove html encoding then parses it and checks the
+// 				  		certificates common name. The affiliation is stored as part of the common name.
+//==============================================================================================================================
+func (t *SimpleChaincode) check_affiliation(stub shim.ChaincodeStubInterface) (string, error) {
+    affiliation, err := stub.ReadCertAttribute("role");
+	if err != nil { return "", errors.New("Couldn't get attribute 'role'. Error: " + err.Error()) }
+	return string(affiliation), nil
+
+}
+
+
+//==============================================================================================================================
+//	 get_caller_data - Calls the get_ecert and check_role functions and returns the ecert and role for the
+//					 name passed.
+//==============================================================================================================================
+func (t *SimpleChaincode) get_caller_data(stub  shim.ChaincodeStubInterface) (string, string, error){	
+
+	user, err := t.get_username(stub)
+
+																		if err != nil { return "", "", err }
+
+	if strings.TrimSpace(user) == "" { return "", "", permission_error("Permission denied. The caller`s certificate has no username") }	// An empty caller would match any record with no owner
+
+	affiliation, err := t.check_affiliation(stub);			
+																		if err != nil { return "", "", err }
+
+	return user, affiliation, nil
 }
 
 //==============================================================================================================================
@@ -192,29 +1092,149 @@ func (t *SimpleChaincode) retrieve_assetID(stub  shim.ChaincodeStubInterface, as
 	
 	var v Asset
 	
+	if strings.TrimSpace(assetID) == "" { return v, invalid_error("RETRIEVE_ASSETID: Invalid assetID, cannot be empty") }
 	
 	bytes, err := stub.GetState(assetID);					
 				
-															if err != nil {	fmt.Printf("RETRIEVE_ASSETID:
-														     Failed to invoke asset_code: %s", err); return v, errors.New("RETRIEVE_ASSETID: Error retrieving asset with assetID = " + assetID) }
+															if err != nil {	fmt.Printf("RETRIEVE_ASSETID: Failed to invoke asset_code: %s", err); return v, errors.New("RETRIEVE_ASSETID: Error retrieving asset with assetID = " + assetID) }
+
+															if bytes == nil { return v, not_found_error("RETRIEVE_ASSETID: Asset not found with assetID = " + assetID) }
 
 	err = json.Unmarshal(bytes, &v);						
 
 															if err != nil {	fmt.Printf("RETRIEVE_ASSETID: Corrupt asset record "+string(bytes)+": %s", err); return v, errors.New("RETRIEVE_ASSETID: Corrupt asset record"+string(bytes))	}
 	
+	err = read_legacy_status(bytes, &v)
+	
+															if err != nil {	fmt.Printf("RETRIEVE_ASSETID: %s", err); return v, err }
+	
+	if 		v.Status < STATE_MINING			||
+			v.Status > STATE_BEING_SCRAPPED		{					// A status outside the lifecycle can only come from a hand built record
+	
+															fmt.Printf("RETRIEVE_ASSETID: Corrupt asset record, status %d out of range", v.Status); return v, errors.New("RETRIEVE_ASSETID: Corrupt asset record, status "+strconv.Itoa(v.Status)+" out of range")
+	}
+	
+	if v.SchemaVersion > SCHEMA_VERSION {					// Written by newer chaincode, reading it here could drop fields this version doesn`t know
+	
+															fmt.Printf("RETRIEVE_ASSETID: Schema version %d is newer than %d", v.SchemaVersion, SCHEMA_VERSION); return v, errors.New("RETRIEVE_ASSETID: Invalid asset record, schema version " + strconv.Itoa(v.SchemaVersion) + " is newer than " + strconv.Itoa(SCHEMA_VERSION))
+	}
+	
+	migrate_asset(&v)										// Older records are upgraded as they are read, the upgrade is stored the next time the diamond is saved
+	
 	return v, nil
 }
 
+//==============================================================================================================================
+//	 read_legacy_status - Older records were written with a capitalised "Status" key. The "status" key is the one records
+//						  are written with, so the legacy key is only read when "status" is absent. json.Unmarshal matches
+//						  keys in any case and the last one wins, so the status is set here from the exact key.
+//==============================================================================================================================
+func read_legacy_status(bytes []byte, v *Asset) error {
+
+	var keys map[string]json.RawMessage
+
+	err := json.Unmarshal(bytes, &keys)
+
+																if err != nil { return errors.New("RETRIEVE_ASSETID: Corrupt asset record") }
+
+	status, ok := keys["status"]
+
+	if !ok { status, ok = keys["Status"] }
+
+	if !ok { return nil }
+
+	err = json.Unmarshal(status, &v.Status)
+
+																if err != nil { return errors.New("RETRIEVE_ASSETID: Corrupt asset record, invalid status " + string(status)) }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 migrate_asset - Upgrades a diamond read from the ledger to the current SCHEMA_VERSION. Records written before the
+//					 version was stored have no schemaVersion and are treated as version 1. Lists the record was
+//					 written without are backfilled as empty so clients never see null for them.
+//==============================================================================================================================
+func migrate_asset(v *Asset) {
+
+	if v.SchemaVersion == 0 { v.SchemaVersion = MIN_SCHEMA_VERSION }
+
+	if v.SchemaVersion < 2 {												// Version 2 added the payment status and normalized fields
+		if v.PaymentStatus == "" { v.PaymentStatus = PAYMENT_UNPAID }
+		normalize_fields(v)
+	}
+
+	if v.OwnershipHistory  == nil { v.OwnershipHistory  = []Ownership_Record{} }
+	if v.InspectionHistory == nil { v.InspectionHistory = []Inspection_Record{} }
+	if v.ImageHashes       == nil { v.ImageHashes       = []string{} }
+	if v.PriceHistory      == nil { v.PriceHistory      = []Price_Record{} }
+	if v.CustodyHistory    == nil { v.CustodyHistory    = []Custody_Record{} }
+	if v.GIAReissues       == nil { v.GIAReissues       = []GIA_Reissue_Record{} }
+	if v.GradingHistory    == nil { v.GradingHistory    = []Grade_Change{} }
+	if v.RepolishHistory   == nil { v.RepolishHistory   = []Repolish_Record{} }
+	if v.StatusHistory     == nil { v.StatusHistory     = []Status_Change{} }
+	if v.Labels            == nil { v.Labels            = []string{} }
+
+	if v.Creator == "" { v.Creator = creator_of(*v) }
+	if v.CreatedAt == "" { v.CreatedAt = created_at(*v) }
+
+	if v.SchemaVersion < SCHEMA_VERSION { v.SchemaVersion = SCHEMA_VERSION }		// Only ever raised, a newer record is refused rather than relabelled
+}
+
 //==============================================================================================================================
 // save_changes - Writes to the ledger the assets struct passed in a JSON format. Uses the shim file`s 
-//				  method `PutState`.
+//				  method `PutState`. Stamps the diamond with the transaction time as it is written.
 //==============================================================================================================================
 func (t *SimpleChaincode) save_changes(stub  shim.ChaincodeStubInterface, v Asset) (bool, error) {
 	 
+	if strings.TrimSpace(v.AssetID) == "" { fmt.Printf("SAVE_CHANGES: Empty assetID"); return false, invalid_error("Invalid asset record, assetID cannot be empty") }
+	
+	if 		v.Scrapped			== true					&&
+			v.Status			!= STATE_BEING_SCRAPPED	{			// A scrapped diamond can only ever be in the being scrapped state
+	
+																fmt.Printf("SAVE_CHANGES: Scrapped asset with status %d", v.Status); return false, invalid_error("Invalid asset record, a scrapped asset must have status being_scrapped")
+	}
+	
+	if 		len(v.OwnershipHistory)	> 0		&&
+			v.OwnershipHistory[len(v.OwnershipHistory)-1].Owner != v.Owner {	// The owner and the ownership history must always be changed together
+	
+																fmt.Printf("SAVE_CHANGES: Owner %s does not match ownership history", v.Owner); return false, invalid_error("Invalid asset record, owner does not match the last ownership history entry")
+	}
+	
+	last_updated, err := t.get_tx_time(stub)
+	
+																if err != nil { fmt.Printf("SAVE_CHANGES: %s", err); return false, err }
+	
+	if v.SchemaVersion < SCHEMA_VERSION {							// Records are migrated as they are read, so an older version here would undo the upgrade
+	
+																fmt.Printf("SAVE_CHANGES: Schema version %d is older than %d", v.SchemaVersion, SCHEMA_VERSION); return false, invalid_error("Invalid asset record, schema version " + strconv.Itoa(v.SchemaVersion) + " is older than " + strconv.Itoa(SCHEMA_VERSION))
+	}
+	
+	if v.SchemaVersion > SCHEMA_VERSION {							// A newer layout can`t be written by this version without losing the fields it added
+	
+																fmt.Printf("SAVE_CHANGES: Schema version %d is newer than %d", v.SchemaVersion, SCHEMA_VERSION); return false, invalid_error("Invalid asset record, schema version " + strconv.Itoa(v.SchemaVersion) + " is newer than " + strconv.Itoa(SCHEMA_VERSION))
+	}
+	
+	v.LastUpdated   = last_updated
+	
+	if v.Scrapped && v.ScrappedAt == "" { v.ScrappedAt = last_updated }		// Stamped the first time the diamond is saved scrapped, whichever function scrapped it
+	
+	normalize_fields(&v)
+	
+	if !is_undefined(v.Diamondat) {									// Kept as the 15 character string it was given so leading zeros survive
+	
+		err = validate_diamondat(v.Diamondat)
+	
+																if err != nil { fmt.Printf("SAVE_CHANGES: %s", err); return false, err }
+	}
+	
 	bytes, err := json.Marshal(v)
 	
 																if err != nil { fmt.Printf("SAVE_CHANGES: Error converting asset record: %s", err); return false, errors.New("Error converting asset record") }
 
+	err = update_owner_index(stub, v)
+	
+																if err != nil { fmt.Printf("SAVE_CHANGES: %s", err); return false, err }
 	
 	err = stub.PutState(v.AssetID, bytes)
 	
@@ -224,652 +1244,4664 @@ func (t *SimpleChaincode) save_changes(stub  shim.ChaincodeStubInterface, v Asse
 	return true, nil
 }
 
+//==============================================================================================================================
+//	 owner_index_key - Returns the owner index key for the owner and diamond passed. The separator can`t appear in a name
+//					   so one owner`s keys never run into another`s in a range query.
+//==============================================================================================================================
+func owner_index_key(owner string, assetID string) string {
+
+	return OWNER_INDEX_PREFIX + owner + "\x00" + assetID
+}
+
+//==============================================================================================================================
+//	 update_owner_index - Moves the diamond`s owner index entry from the owner on the ledger to the owner of the copy
+//						  passed. Must be called before the copy passed is written.
+//==============================================================================================================================
+func update_owner_index(stub  shim.ChaincodeStubInterface, v Asset) error {
+
+	bytes, err := stub.GetState(v.AssetID)
+
+																if err != nil { return errors.New("Error retrieving asset record") }
+
+	if bytes != nil {
+
+		var previous struct { Owner string `json:"owner"` }
+
+		err = json.Unmarshal(bytes, &previous)
+
+																if err != nil { return errors.New("Corrupt asset record " + v.AssetID) }
+
+		if previous.Owner == v.Owner { return nil }
+
+		err = stub.DelState(owner_index_key(previous.Owner, v.AssetID))
+
+																if err != nil { return errors.New("Error removing owner index entry") }
+	}
+
+	err = stub.PutState(owner_index_key(v.Owner, v.AssetID), []byte(v.AssetID))
+
+																if err != nil { return errors.New("Error storing owner index entry") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 rebuild_owner_index - Clears the owner index and rebuilds it from the owner on every diamond, for when it has drifted
+//						   after bulk corrections. Only the Miner can do this. Returns the number of diamonds indexed.
+//==============================================================================================================================
+func (t *SimpleChaincode) rebuild_owner_index(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission denied. rebuild_owner_index") }
+
+	iter, err := stub.RangeQueryState(OWNER_INDEX_PREFIX, OWNER_INDEX_PREFIX + "\xff")
+
+																if err != nil { return nil, errors.New("Error reading owner index") }
+
+	var stale []string
+
+	for iter.HasNext() {
+
+		key, _, err := iter.Next()
+
+																if err != nil { iter.Close(); return nil, errors.New("Error reading owner index") }
+
+		if !strings.HasPrefix(key, OWNER_INDEX_PREFIX) { continue }		// Only ever delete index entries, whatever the range returns
+
+		stale = append(stale, key)
+	}
+
+	iter.Close()
+
+	for _, key := range stale {
+
+		err = stub.DelState(key)
+
+																if err != nil { return nil, errors.New("Error removing owner index entry") }
+	}
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																if err != nil { return nil, err }
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+																if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		err = stub.PutState(owner_index_key(v.Owner, v.AssetID), []byte(v.AssetID))
+
+																if err != nil { return nil, errors.New("Error storing owner index entry") }
+	}
+
+	return []byte(strconv.Itoa(len(assetIDs.AssetIDs))), nil
+}
+
+//==============================================================================================================================
+//	 retrieve_owned_ids - Returns the assetIDs the owner index lists for the owner passed. Keys outside the owner`s range
+//						  are skipped as well as bounded so a peer that returns extra keys can`t add other owners` diamonds.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_owned_ids(stub  shim.ChaincodeStubInterface, owner string) ([]string, error) {
+
+	start := owner_index_key(owner, "")
+
+	iter, err := stub.RangeQueryState(start, start + "\xff")
+
+																if err != nil { return nil, errors.New("Error reading owner index") }
+
+	defer iter.Close()
+
+	assetIDs := []string{}
+
+	for iter.HasNext() {
+
+		key, value, err := iter.Next()
+
+																if err != nil { return nil, errors.New("Error reading owner index") }
+
+		if !strings.HasPrefix(key, start) { continue }
+
+		assetIDs = append(assetIDs, string(value))
+	}
+
+	return assetIDs, nil
+}
+
+
+//==============================================================================================================================
+//	 get_tx_time - Returns the transaction timestamp in RFC3339 format. The timestamp comes from the transaction rather
+//				   than the local clock so that every peer writes the same value.
+//==============================================================================================================================
+func (t *SimpleChaincode) get_tx_time(stub  shim.ChaincodeStubInterface) (string, error) {
+
+	ts, err := stub.GetTxTimestamp()
+
+																if err != nil { return "", errors.New("Couldn`t get transaction timestamp. Error: " + err.Error()) }
+
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339), nil
+}
+
+//==============================================================================================================================
+//	 append_ownership - Adds an entry to the ownership history of the diamond passed. Only changes the in memory copy,
+//						nothing is recorded unless the caller goes on to save the diamond.
+//==============================================================================================================================
+func (t *SimpleChaincode) append_ownership(stub  shim.ChaincodeStubInterface, v *Asset, from string, owner string, affiliation string) error {
+
+	timestamp, err := t.get_tx_time(stub)
+
+																if err != nil { return err }
+
+	v.OwnershipHistory = append(v.OwnershipHistory, Ownership_Record{From: from, Owner: owner, Affiliation: affiliation, Timestamp: timestamp})
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 change_status - Moves the diamond to the status passed and records the change in its status history. initial is
+//					 set for the entry written when the diamond is created. Only changes the in memory copy, the caller is
+//					 responsible for saving.
+//==============================================================================================================================
+func (t *SimpleChaincode) change_status(stub  shim.ChaincodeStubInterface, v *Asset, status int, changed_by string, initial bool) error {
+
+	timestamp, err := t.get_tx_time(stub)
+
+																if err != nil { return err }
+
+	from := status_labels[v.Status]
+
+	if initial { from = "" }
+
+	v.StatusHistory = append(v.StatusHistory, Status_Change{From: from, To: status_labels[status], ChangedBy: changed_by, Timestamp: timestamp})
+	v.Status        = status
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 increment_transfer_count - Adds one to the count of transfers made across the whole network.
+//==============================================================================================================================
+func (t *SimpleChaincode) increment_transfer_count(stub  shim.ChaincodeStubInterface) error {
+
+	count, err := t.retrieve_transfer_count(stub)
+
+																if err != nil { return err }
+
+	err = stub.PutState("transfer_count", []byte(strconv.Itoa(count + 1)))
+
+																if err != nil { fmt.Printf("INCREMENT_TRANSFER_COUNT: Error storing count: %s", err); return errors.New("Error storing transfer count") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 count_create - Counts a create against the miner passed for the current create window, refusing it once the miner has
+//					reached the configured create limit. Windows are fixed blocks of createWindow seconds so a new window
+//					starts with a fresh count.
+//==============================================================================================================================
+func (t *SimpleChaincode) count_create(stub  shim.ChaincodeStubInterface, miner string, config Chaincode_Config) error {
+
+	now, err := t.get_tx_time(stub)
+
+																if err != nil { return err }
+
+	current, _ := time.Parse(time.RFC3339, now)
+
+	key := CREATE_COUNT_PREFIX + miner + "_" + strconv.FormatInt(current.Unix() / int64(config.CreateWindow), 10)
+
+	bytes, err := stub.GetState(key)
+
+																if err != nil { return errors.New("Unable to get create count") }
+
+	count := 0
+
+	if bytes != nil {
+		count, err = strconv.Atoi(string(bytes))
+
+																if err != nil { return errors.New("Corrupt create count record") }
+	}
+
+	if count >= config.CreateLimit {
+																return invalid_error("Invalid create, " + miner + " has reached the limit of " + strconv.Itoa(config.CreateLimit) + " diamonds per " + strconv.Itoa(config.CreateWindow) + " seconds")
+	}
+
+	err = stub.PutState(key, []byte(strconv.Itoa(count + 1)))
+
+																if err != nil { fmt.Printf("COUNT_CREATE: Error storing count: %s", err); return errors.New("Error storing create count") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 retrieve_transfer_count - Reads the count of transfers made across the whole network, 0 if none have been made.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_transfer_count(stub  shim.ChaincodeStubInterface) (int, error) {
+
+	bytes, err := stub.GetState("transfer_count")
+
+																if err != nil { return 0, errors.New("Unable to get transfer count") }
+
+	if bytes == nil { return 0, nil }
+
+	count, err := strconv.Atoi(string(bytes))
+
+																if err != nil { return 0, errors.New("Corrupt transfer count record") }
+
+	return count, nil
+}
+
+//==============================================================================================================================
+//	 retrieve_asset_ids - Reads the index of all assetIDs that have been created.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_asset_ids(stub  shim.ChaincodeStubInterface) (AssetID_Holder, error) {
+
+	var assetIDs AssetID_Holder
+
+	bytes, err := stub.GetState("assetIDs")
+
+																if err != nil { return assetIDs, errors.New("Unable to get assetIDs") }
+
+	err = json.Unmarshal(bytes, &assetIDs)
+
+																if err != nil { return assetIDs, errors.New("Corrupt AssetID_Holder record") }
+
+	return assetIDs, nil
+}
+
+//==============================================================================================================================
+//	 save_asset_ids - Writes the index of assetIDs back to the ledger.
+//==============================================================================================================================
+func (t *SimpleChaincode) save_asset_ids(stub  shim.ChaincodeStubInterface, assetIDs AssetID_Holder) error {
+
+	bytes, err := json.Marshal(assetIDs)
+
+																if err != nil { return errors.New("Error creating AssetID_Holder record") }
+
+	err = stub.PutState("assetIDs", bytes)
+
+																if err != nil { fmt.Printf("SAVE_ASSET_IDS: Error storing assetIDs: %s", err); return errors.New("Unable to put the state") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 retrieve_freeze - Reads the global freeze record. The network isn`t frozen if no record has been written.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_freeze(stub  shim.ChaincodeStubInterface) (Freeze_State, error) {
+
+	var freeze Freeze_State
+
+	bytes, err := stub.GetState("global_freeze")
+
+																if err != nil { return freeze, errors.New("Unable to get global freeze") }
+
+	if bytes == nil { return freeze, nil }
+
+	err = json.Unmarshal(bytes, &freeze)
+
+																if err != nil { return freeze, errors.New("Corrupt global freeze record") }
+
+	return freeze, nil
+}
+
+//==============================================================================================================================
+//	 set_global_freeze - Pauses or resumes every transfer and update on the network. Only the Miner can do this and a
+//						 reason must be given when freezing.
+//==============================================================================================================================
+func (t *SimpleChaincode) set_global_freeze(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, frozen_arg string, reason string) ([]byte, error) {
+
+	if caller_affiliation != MINER {
+																return nil, permission_error("Permission denied. set_global_freeze")
+	}
+
+	frozen, err := strconv.ParseBool(frozen_arg)
+
+																if err != nil { return nil, invalid_error("Invalid frozen value " + frozen_arg) }
+
+	if frozen && strings.TrimSpace(reason) == "" {
+																return nil, invalid_error("Invalid freeze, a reason must be given")
+	}
+
+	timestamp, err := t.get_tx_time(stub)
+
+																if err != nil { return nil, err }
+
+	bytes, err := json.Marshal(Freeze_State{Frozen: frozen, Reason: reason, SetBy: caller, Timestamp: timestamp})
+
+																if err != nil { return nil, errors.New("Error converting global freeze record") }
+
+	err = stub.PutState("global_freeze", bytes)
+
+																if err != nil { fmt.Printf("SET_GLOBAL_FREEZE: Error storing global freeze: %s", err); return nil, errors.New("Error storing global freeze") }
+
+	return nil, nil
+}
+
+//==============================================================================================================================
+//	 retrieve_config - Returns the configuration in use, the defaults with any values MINER has overridden on top.
+//==============================================================================================================================
+func (t *SimpleChaincode) retrieve_config(stub  shim.ChaincodeStubInterface) (Chaincode_Config, error) {
+
+	config := Chaincode_Config{AssetIDPattern: ASSET_ID_PATTERN, MaxBatch: MAX_BATCH, MaxAssets: MAX_ASSETS, CreateLimit: CREATE_LIMIT, CreateWindow: CREATE_WINDOW}
+
+	bytes, err := stub.GetState("config")
+
+																if err != nil { return config, errors.New("Unable to get config") }
+
+	if bytes == nil { return config, nil }
+
+	err = json.Unmarshal(bytes, &config)
+
+																if err != nil { return config, errors.New("Corrupt config record") }
+
+	return config, nil
+}
+
+//==============================================================================================================================
+//	 validate_asset_id - Checks the assetID passed fits the configured pattern.
+//==============================================================================================================================
+func (t *SimpleChaincode) validate_asset_id(stub  shim.ChaincodeStubInterface, assetID string) error {
+
+	config, err := t.retrieve_config(stub)
+
+																if err != nil { return err }
+
+	matched, err := regexp.Match(config.AssetIDPattern, []byte(assetID))
+
+																if err != nil || assetID == "" || matched == false { return invalid_error("Invalid assetID provided: " + assetID) }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 get_grade_vocabulary - Returns the allowed grades for the field passed. Uses the set stored on the ledger if MINER has
+//							set one, otherwise falls back to the defaults.
+//==============================================================================================================================
+func (t *SimpleChaincode) get_grade_vocabulary(stub  shim.ChaincodeStubInterface, field string) ([]string, error) {
+
+	defaults, ok := default_grade_vocabularies[field]
+
+																if !ok { return nil, invalid_error("Unknown grading field " + field) }
+
+	bytes, err := stub.GetState(GRADE_VOCABULARY_PREFIX + field)
+
+																if err != nil { fmt.Printf("GET_GRADE_VOCABULARY: Error retrieving vocabulary: %s", err); return nil, errors.New("Error retrieving vocabulary for " + field) }
+
+	if bytes == nil { return defaults, nil }
+
+	var values []string
+
+	err = json.Unmarshal(bytes, &values)
+
+																if err != nil { return nil, errors.New("Corrupt vocabulary record for " + field) }
+
+	return values, nil
+}
+
+//==============================================================================================================================
+//	 validate_grade - Checks the value passed is one of the allowed grades for the field.
+//==============================================================================================================================
+func (t *SimpleChaincode) validate_grade(stub  shim.ChaincodeStubInterface, field string, value string) error {
+
+	values, err := t.get_grade_vocabulary(stub, field)
+
+																if err != nil { return err }
+
+	for _, allowed := range values {
+		if allowed == strings.TrimSpace(value) { return nil }
+	}
+
+	return invalid_error("Invalid " + field + " grade: " + value)
+}
+
+//==============================================================================================================================
+//	 check_diamondat_assigned - Grading can only start once the diamond has been given its Diamondat.
+//==============================================================================================================================
+func (t *SimpleChaincode) check_diamondat_assigned(v Asset) error {
+
+	if is_undefined(v.Diamondat) {
+																return invalid_error("Diamondat must be assigned before the diamond can be graded")
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 apply_grade - Validates the grade passed and sets it on the diamond, recording the change in the grading history.
+//				   Only changes the in memory copy, the caller is responsible for saving.
+//==============================================================================================================================
+func (t *SimpleChaincode) apply_grade(stub  shim.ChaincodeStubInterface, v *Asset, field string, value string, changed_by string) error {
+
+	err := t.check_diamondat_assigned(*v)
+
+																if err != nil { return err }
+
+	err = t.validate_grade(stub, field, value)
+
+																if err != nil { return err }
+
+	value = strings.TrimSpace(value)
+
+	old_value := grade_value(*v, field)
+
+	if old_value != value {
+
+		timestamp, err := t.get_tx_time(stub)
+
+																if err != nil { return err }
+
+		v.GradingHistory = append(v.GradingHistory, Grade_Change{Field: field, Old: old_value, New: value, ChangedBy: changed_by, Timestamp: timestamp})
+	}
+
+	if 		   field == "clarity"  { v.Clarity  = value
+	} else if  field == "cut"      { v.Cut      = value
+	} else if  field == "colour"   { v.Colour   = value
+	} else if  field == "polish"   { v.Polish   = value
+	} else if  field == "symmetry" { v.Symmetry = value
+	} else if  field == "fluorescence" { v.Fluorescence = value
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 grade_problems - Checks every grade in the map passed against the diamond and the vocabularies and returns all the
+//					  problems found, sorted so every peer reports them in the same order.
+//==============================================================================================================================
+func (t *SimpleChaincode) grade_problems(stub  shim.ChaincodeStubInterface, v Asset, grades map[string]string) []string {
+
+	problems := []string{}
+
+	err := t.check_diamondat_assigned(v)
+
+																if err != nil { problems = append(problems, err.Error()) }
+
+	for field, value := range grades {
+
+		err = t.validate_grade(stub, field, value)
+
+																if err != nil { problems = append(problems, err.Error()) }
+	}
+
+	sort.Strings(problems)
+
+	return problems
+}
+
+//==============================================================================================================================
+//	 validation_error - Turns a list of problems into a single error carrying them all as a JSON array.
+//==============================================================================================================================
+func validation_error(problems []string) error {
+
+	bytes, err := json.Marshal(problems)
+
+																if err != nil { return invalid_error("Invalid request") }
+
+	return invalid_error("Invalid request, problems: " + string(bytes))
+}
+
+//==============================================================================================================================
+//	 coded_error - An error raised where the failure happens, carrying the error code the client should see. Plain errors
+//				   are the chaincode`s own failures (ledger reads and writes, corrupt records) and are reported as internal.
+//==============================================================================================================================
+type coded_error struct {
+	code    int
+	message string
+}
+
+func (e *coded_error) Error() string { return e.message }
+
+func invalid_error(message string) error    { return &coded_error{code: ERR_VALIDATION, message: message} }
+func permission_error(message string) error { return &coded_error{code: ERR_PERMISSION, message: message} }
+func not_found_error(message string) error  { return &coded_error{code: ERR_NOT_FOUND, message: message} }
+
+//==============================================================================================================================
+//	 wrap_error - Prefixes the message of an error while keeping its code.
+//==============================================================================================================================
+func wrap_error(prefix string, err error) error {
+
+	return &coded_error{code: error_code(err), message: prefix + err.Error()}
+}
+
+//==============================================================================================================================
+//	 error_code - Returns the code of an error raised through coded_error, ERR_INTERNAL for any other error.
+//==============================================================================================================================
+func error_code(err error) int {
+
+	if coded, ok := err.(*coded_error); ok { return coded.code }
+
+	return ERR_INTERNAL
+}
+
+//==============================================================================================================================
+//	 to_coded_error - Converts an error into one whose message is a Coded_Error JSON object. Returns nil for nil.
+//==============================================================================================================================
+func to_coded_error(err error) error {
+
+	if err == nil { return nil }
+
+	bytes, e := json.Marshal(Coded_Error{Code: error_code(err), Message: err.Error()})
+
+																if e != nil { return err }
+
+	return errors.New(string(bytes))
+}
+
+//==============================================================================================================================
+//	 grade_value - Returns the grade on record for the grading field passed, empty for an unknown field.
+//==============================================================================================================================
+func grade_value(v Asset, field string) string {
+
+	if 		   field == "clarity"  { return v.Clarity
+	} else if  field == "cut"      { return v.Cut
+	} else if  field == "colour"   { return v.Colour
+	} else if  field == "polish"   { return v.Polish
+	} else if  field == "symmetry" { return v.Symmetry
+	} else if  field == "fluorescence" { return v.Fluorescence
+	}
+
+	return ""
+}
+
+//==============================================================================================================================
+//	 gzip_response - Gzip compresses a query response and base64 encodes it so it is still safe to return as text.
+//==============================================================================================================================
+func gzip_response(response []byte) ([]byte, error) {
+
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+
+	_, err := writer.Write(response)
+
+																if err != nil { return nil, errors.New("Error compressing response") }
+
+	err = writer.Close()
+
+																if err != nil { return nil, errors.New("Error compressing response") }
+
+	return []byte(base64.StdEncoding.EncodeToString(buffer.Bytes())), nil
+}
+
+//==============================================================================================================================
+//	 check_updatable - The preconditions every function changing a diamond shares. A diamond can`t be changed once it is
+//					   scrapped, or while it is held or disputed. route_invoke applies it to every function working on a
+//					   single diamond apart from those in flag_functions, functions working on several diamonds apply it
+//					   to each one.
+//==============================================================================================================================
+var flag_functions = map[string]bool{							// The Miner`s functions that set or clear these conditions, or act in spite of them
+	"set_held":       true,
+	"set_disputed":   true,
+	"set_archived":   true,
+	"admin_transfer": true,
+}
+
+func check_updatable(v Asset) error {
+
+	if v.Scrapped { return invalid_error("Invalid update, asset " + v.AssetID + " is scrapped") }
+	if v.Held     { return invalid_error("Invalid update, asset " + v.AssetID + " is held") }
+	if v.Disputed { return invalid_error("Invalid update, asset " + v.AssetID + " is disputed") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 check_transferable - check_updatable for the functions that pass a diamond to a new owner, which report a scrapped
+//						  diamond as one that can`t be transferred any more.
+//==============================================================================================================================
+func check_transferable(v Asset) error {
+
+	if v.Scrapped { return invalid_error("Diamond is scrapped; no further transfers allowed") }
+
+	return check_updatable(v)
+}
+
+//==============================================================================================================================
+//	 is_transfer_function - Returns true if the invoke function passed moves a single diamond to a new owner.
+//==============================================================================================================================
+func is_transfer_function(function string) bool {
+
+	_, named := transfer_edges[function]
+
+	return 	named									||
+			function == "transfer"					||
+			function == "transfer_with_document"	||
+			function == "transfer_to_verified"		||
+			function == "distribute_and_transfer"
+}
+
+//==============================================================================================================================
+//	 validate_diamondat - Checks the value passed is a Diamondat, a 15 digit identifier. Diamondats are identifiers
+//						  rather than numbers, so they are never parsed and leading zeros are significant.
+//==============================================================================================================================
+func validate_diamondat(diamondat string) error {
+
+	matched, err := regexp.MatchString("^[0-9]{15}$", diamondat)
+
+																if err != nil || matched == false { return invalid_error("Invalid Diamondat " + diamondat + ", expected 15 digits") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 is_freezable_function - Returns true if the invoke function passed is refused while the network is frozen. Every
+//							 function is frozen except the Miner`s admin functions listed in freeze_exempt_functions,
+//							 which stay available so the Miner can deal with the emergency. A new function is frozen
+//							 unless it is added to that list.
+//==============================================================================================================================
+var freeze_exempt_functions = map[string]bool{
+	"ping":                 true,
+	"set_global_freeze":    true,
+	"set_config":           true,
+	"set_grade_vocabulary": true,
+	"set_qr_signing_key":   true,
+	"revoke_user":          true,
+	"reinstate_user":       true,
+	"verify_user":          true,
+	"unverify_user":        true,
+	"rebuild_owner_index":  true,
+	"admin_transfer":       true,
+	"set_held":             true,
+	"set_disputed":         true,
+}
+
+func is_freezable_function(function string) bool {
+
+	return !freeze_exempt_functions[function]
+}
+
+//==============================================================================================================================
+//	 is_grading_function - Returns true if the invoke function passed can change a diamond`s grades.
+//==============================================================================================================================
+func is_grading_function(function string) bool {
+
+	if function == "batch_update_grade" || function == "distribute_and_transfer" { return true }
+
+	_, ok := default_grade_vocabularies[strings.TrimPrefix(function, "update_")]
+
+	return ok && strings.HasPrefix(function, "update_")
+}
+
+//==============================================================================================================================
+//	 normalize_value - Trims the whitespace from a value and uppercases the UNDEFINED sentinel, so a value stored as
+//					   " undefined " is still recognised as unset.
+//==============================================================================================================================
+func normalize_value(value string) string {
+
+	value = strings.TrimSpace(value)
+
+	if strings.ToUpper(value) == "UNDEFINED" { return "UNDEFINED" }
+
+	return value
+}
+
+//==============================================================================================================================
+//	 is_undefined - Returns true if the value is empty or the UNDEFINED sentinel, in any casing or padding.
+//==============================================================================================================================
+func is_undefined(value string) bool {
+
+	value = normalize_value(value)
+
+	return value == "" || value == "UNDEFINED"
+}
+
+//==============================================================================================================================
+//	 normalize_fields - Normalizes the grading and descriptive fields of the diamond before it is written.
+//==============================================================================================================================
+func normalize_fields(v *Asset) {
+
+	v.Colour        = normalize_value(v.Colour)
+	v.Diamondat     = normalize_value(v.Diamondat)
+	v.Cut           = normalize_value(v.Cut)
+	v.Clarity       = normalize_value(v.Clarity)
+	v.Location      = normalize_value(v.Location)
+	v.Origin        = normalize_value(v.Origin)
+	v.Polish        = normalize_value(v.Polish)
+	v.Symmetry      = normalize_value(v.Symmetry)
+	v.Fluorescence  = normalize_value(v.Fluorescence)
+	v.GIACert       = normalize_value(v.GIACert)
+	v.JewelleryType = normalize_value(v.JewelleryType)
+}
+
+//==============================================================================================================================
+//	 validate_sha256 - Checks the value passed is a SHA-256 hash written as 64 hex characters.
+//==============================================================================================================================
+func validate_sha256(hash string) error {
+
+	matched, err := regexp.MatchString("^[0-9a-fA-F]{64}$", hash)
+
+																if err != nil || matched == false { return invalid_error("Invalid hash " + hash + ", expected 64 hex characters of SHA-256") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 field_value - Returns the value of a grade or one of the other string fields checked by the transfer edges.
+//==============================================================================================================================
+func field_value(v Asset, field string) string {
+
+	if 		   field == "jewellerytype" { return v.JewelleryType
+	} else if  field == "location"      { return v.Location
+	} else if  field == "diamondat"     { return v.Diamondat
+	} else if  field == "origin"        { return v.Origin
+	}
+
+	return grade_value(v, field)
+}
+
+//==============================================================================================================================
+//	 Router Functions
+//==============================================================================================================================
+//	Invoke - Called on chaincode invoke. Takes a function name passed and calls that function. Converts some
+//		  initial arguments passed to other things for use in the called function e.g. name -> ecert
+//==============================================================================================================================
+func (t *SimpleChaincode) Invoke(stub  shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+
+	result, err := t.route_invoke(stub, function, args)
+
+	return result, to_coded_error(err)
+}
+
+//==============================================================================================================================
+//	route_invoke - Dispatches an invoke to the function named. Errors are returned as raised, Invoke converts them into
+//				   coded errors for the client.
+//==============================================================================================================================
+func (t *SimpleChaincode) route_invoke(stub  shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+
+	if _, ok := invoke_functions[function]; !ok { return nil, invalid_error("Function of that name doesn`t exist.") }
+	
+	caller, caller_affiliation, err := t.get_caller_data(stub)
+
+	if err != nil { return nil, wrap_error("Error retrieving caller information: ", err)}
+
+	if !known_roles[caller_affiliation] { return nil, permission_error("Permission denied. Unrecognised role \"" + caller_affiliation + "\" in the caller`s certificate") }
+
+	if is_grading_function(function) && caller_affiliation == SCRAP_MERCHANT { return nil, permission_error("Permission denied. Scrap merchants cannot change grades") }
+
+	if is_freezable_function(function) {
+		freeze, err := t.retrieve_freeze(stub)
+																							if err != nil { return nil, err }
+		if freeze.Frozen { return nil, invalid_error("Transfers and updates are frozen: " + freeze.Reason) }
+	}
+	
+	if function == "create_asset" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.create_asset(stub, caller, caller_affiliation, args[0])
+	} else if function == "ping" {
+        return t.ping(stub)
+	} else if function == "mint_diamond" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.mint_diamond(stub, caller, caller_affiliation, args[0])
+	} else if function == "batch_update_grade" {
+		if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.batch_update_grade(stub, caller, caller_affiliation, args[0], args[1], args[2])
+	} else if function == "import_asset_ids" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.import_asset_ids(stub, caller, caller_affiliation, args[0])
+	} else if function == "revoke_user" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_revoked(stub, caller, caller_affiliation, args[0], true)
+	} else if function == "reinstate_user" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_revoked(stub, caller, caller_affiliation, args[0], false)
+	} else if function == "rebuild_owner_index" {
+		return t.rebuild_owner_index(stub, caller, caller_affiliation)
+	} else if function == "verify_user" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_verified(stub, caller, caller_affiliation, args[0], true)
+	} else if function == "unverify_user" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_verified(stub, caller, caller_affiliation, args[0], false)
+	} else if function == "set_config" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_config(stub, caller, caller_affiliation, args[0])
+	} else if function == "set_grade_vocabulary" {
+		if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_grade_vocabulary(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "link_rough" {
+		if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.link_rough(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "import_snapshot" {
+		if len(args) != 1 && len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.import_snapshot(stub, caller, caller_affiliation, args[0], len(args) == 2 && args[1] == "true")
+	} else if function == "create_jewellery" {
+		if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.create_jewellery(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "set_global_freeze" {
+		if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_global_freeze(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "set_qr_signing_key" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.set_qr_signing_key(stub, caller, caller_affiliation, args[0])
+	} else if function == "batch_assign_diamondat" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.batch_assign_diamondat(stub, caller, caller_affiliation, args[0])
+	} else if function == "batch_transfer" {
+		if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.batch_transfer(stub, caller, caller_affiliation, args[0], args[1], args[2])
+	} else if function == "scrap_jewellery" {
+		if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.scrap_jewellery(stub, caller, caller_affiliation, args[0])
+	} else if function == "bulk_scrap" {
+		if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+		return t.bulk_scrap(stub, caller, caller_affiliation, args[0], args[1])
+    }  else { 																				// If the function is not a create then there must be a Diamond so we need to retrieve the Diamond.
+		
+		argPos := 1
+		
+		if function == "scrap_asset" {																// If its a scrap assets then only two arguments are passed (no update value) all others have three arguments and the assetid is expected in the last argument
+			if len(args) != 1 && len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "distribute_and_transfer" {											// distribute_and_transfer takes the assetID first followed by the grades and recipient
+			if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "transfer_with_document" {											// transfer_with_document takes the assetID, recipient, transfer type and document hash
+			if len(args) != 4 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "transfer_to_verified" {												// transfer_to_verified takes the assetID, recipient and transfer type
+			if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "set_metadata" {														// set_metadata takes the assetID followed by the key and value
+			if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "customer_write_off" {												// customer_write_off takes the assetID followed by the reason
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "approve_write_off" {												// approve_write_off takes the assetID
+			if len(args) != 1 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "record_inspection" {												// record_inspection takes the assetID followed by the inspected grades
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "transfer" {															// transfer takes the assetID, recipient, the name of the edge and optionally whether to keep the custodian
+			if len(args) != 3 && len(args) != 4 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "set_custodian" || function == "transfer_custody" {					// set_custodian and transfer_custody take the assetID followed by the custodian
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "set_archived" || function == "set_held" || function == "set_disputed" {	// set_archived, set_held and set_disputed take the assetID followed by true or false
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "set_kp_cert" {														// set_kp_cert takes the assetID followed by the certificate number
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "add_label" || function == "remove_label" {							// add_label and remove_label take the assetID followed by the label
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "add_image_hash" {													// add_image_hash takes the assetID followed by the hash
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "record_repolish" {													// record_repolish takes the assetID followed by the new carat weight and the reason
+			if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "admin_transfer" {													// admin_transfer takes the assetID, new owner, their affiliation and the reason
+			if len(args) != 4 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "reissue_gia_cert" {												// reissue_gia_cert takes the assetID followed by the new number and the reason
+			if len(args) != 3 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if function == "record_price" {														// record_price takes the assetID followed by the price
+			if len(args) != 2 { return nil, invalid_error("Incorrect number of arguments passed") }
+			argPos = 0
+		} else if len(args) != 2 {																	// Every other function takes the new value or recipient followed by the assetID
+			return nil, invalid_error("Incorrect number of arguments passed")
+		}
+		
+		v, err := t.retrieve_assetID(stub, args[argPos])
+		
+																							if err != nil { fmt.Printf("INVOKE: Error retrieving assetID: %s", err); return nil, wrap_error("Error retrieving assetID: ", err) }
+		
+		if !flag_functions[function] {																// Every function that changes the diamond goes through the same preconditions so a new one can`t miss them
+			if is_transfer_function(function) { err = check_transferable(v) } else { err = check_updatable(v) }
+																							if err != nil { return nil, err }
+		}
+																		
+		if strings.Contains(function, "update") == false           && 
+		   function 							!= "scrap_asset"    { 									// If the function is not an update or a scrappage it must be a transfer so we need to get the ecert of the recipient.
+			
+					
+				if 		   function == "distribute_and_transfer" { return t.distribute_and_transfer(stub, v, caller, caller_affiliation, args[1], args[2], "dealership")
+				} else if  function == "transfer_with_document" { return t.transfer_with_document(stub, v, caller, caller_affiliation, args[1], args[2], args[3])
+				} else if  function == "transfer_to_verified" { return t.transfer_to_verified(stub, v, caller, caller_affiliation, args[1], args[2])
+				} else if  function == "set_metadata" { return t.set_metadata(stub, v, caller, caller_affiliation, args[1], args[2])
+				} else if  function == "customer_write_off" { return t.customer_write_off(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "approve_write_off" { return t.approve_write_off(stub, v, caller, caller_affiliation)
+				} else if  function == "record_inspection" { return t.record_inspection(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "transfer" { return t.move_along_edge(stub, v, caller, caller_affiliation, args[2], args[1], len(args) == 4 && args[3] == "true", "")
+				} else if  function == "set_custodian" { return t.set_custodian(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "transfer_custody" { return t.transfer_custody(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "set_archived" { return t.set_archived(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "set_held" { return t.set_held(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "set_disputed" { return t.set_disputed(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "add_image_hash" { return t.add_image_hash(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "set_kp_cert" { return t.set_kp_cert(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "add_label" { return t.add_label(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "remove_label" { return t.remove_label(stub, v, caller, caller_affiliation, args[1])
+				} else if  function == "record_repolish" { return t.record_repolish(stub, v, caller, caller_affiliation, args[1], args[2])
+				} else if  function == "admin_transfer" { return t.admin_transfer(stub, v, caller, caller_affiliation, args[1], args[2], args[3])
+				} else if  function == "reissue_gia_cert" { return t.reissue_gia_cert(stub, v, caller, caller_affiliation, args[1], args[2])
+				} else if  function == "record_price" { return t.record_price(stub, v, caller, caller_affiliation, args[1])
+				} else { return t.dispatch_transfer(stub, v, caller, caller_affiliation, function, args[0])
+                                }
+			
+		} else if function == "update_colour"  	    { return t.update_colour(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_cut"          { return t.update_cut(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_clarity"   { return t.update_clarity(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_symmetry" 		{ return t.update_symmetry(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_polish" 		{ return t.update_polish(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_fluorescence" 		{ return t.update_fluorescence(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_diamondat" 		{ return t.update_diamondat(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_date" 		{ return t.update_date(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_timestamp" 		{ return t.update_timestamp(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_jewellerytype" 		{ return t.update_jewellerytype(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_gia_cert" 		{ return t.update_gia_cert(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_origin" 		{ return t.update_origin(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_location" 		{ return t.update_location(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_carat" 		{ return t.update_carat(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_payment_status" 		{ return t.update_payment_status(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "scrap_asset" 		{
+			cert_hash := ""
+			if len(args) == 2 { cert_hash = args[1] }												// The destruction certificate is optional
+			return t.scrap_asset(stub, v, caller, caller_affiliation, cert_hash)
+		} 
+		
+																						return nil, invalid_error("Function of that name doesn`t exist.")
+			
+
+	}
+}
+//=================================================================================================================================
+//	 check_unique_asset
+//=================================================================================================================================
+func (t *SimpleChaincode) check_unique_asset(stub shim.ChaincodeStubInterface, asset string, caller string, caller_affiliation string) ([]byte, error) {
+	_, err := t.retrieve_assetID(stub, asset)
+	if err == nil {
+		return []byte("false"), invalid_error("Asset is not unique")
+	} else {
+		return []byte("true"), nil
+	}
+}
+//=================================================================================================================================	//	Query - Called on chaincode query. Takes a function name passed and calls that function. Passes the
+//  		initial arguments passed are passed on to the called function.
+//=================================================================================================================================	
+func (t *SimpleChaincode) Query(stub  shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+
+	result, err := t.route_query(stub, function, args)
+
+	return result, to_coded_error(err)
+}
+
+//=================================================================================================================================
+//	route_query - Dispatches a query to the function named. As with route_invoke errors are converted by the caller.
+//=================================================================================================================================
+func (t *SimpleChaincode) route_query(stub  shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+
+	if _, ok := query_functions[function]; !ok { return nil, invalid_error("Received unknown function invocation" + function) }
+													
+	caller, caller_affiliation, err := t.get_caller_data(stub)
+
+																							if err != nil { fmt.Printf("QUERY: Error retrieving caller details: %s", err); return nil, wrap_error("QUERY: Error retrieving caller details: ", err) }
+	logger.Debug("function: ", function)
+    logger.Debug("caller: ", caller)
+    logger.Debug("affiliation: ", caller_affiliation)
+
+
+	if function == "get_asset_details" { 
+	
+			if len(args) != 1 { fmt.Printf("Incorrect number of arguments passed"); return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+	
+	
+			v, err := t.retrieve_assetID(stub, args[0])
+																							if err != nil { fmt.Printf("QUERY: Error retrieving asseID: %s", err); return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+	
+			return t.get_asset_details(stub, v, caller, caller_affiliation)
+			
+	} else if function == "check_unique_assetID" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.check_unique_asset(stub, args[0], caller, caller_affiliation)
+	} else if function == "get_assets" {
+		if len(args) > 3 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		include_archived, include_held, compress := false, false, false
+		if len(args) > 0 { include_archived, err = strconv.ParseBool(args[0]); if err != nil { return nil, invalid_error("QUERY: Invalid includeArchived " + args[0]) } }
+		if len(args) > 1 { include_held, err = strconv.ParseBool(args[1]);     if err != nil { return nil, invalid_error("QUERY: Invalid includeHeld " + args[1]) } }
+		if len(args) > 2 { compress, err = strconv.ParseBool(args[2]);         if err != nil { return nil, invalid_error("QUERY: Invalid gzip " + args[2]) } }
+		result, err := t.get_assets(stub, caller, caller_affiliation, include_archived, include_held)
+																								if err != nil || !compress { return result, err }
+		return gzip_response(result)
+	} else if function == "get_ecert" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_ecert(stub, args[0])
+	} else if function == "get_grade_vocabulary" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		values, err := t.get_grade_vocabulary(stub, args[0])
+																								if err != nil { return nil, err }
+		return json.Marshal(values)
+	} else if function == "ping" {
+		return t.ping(stub)
+	} else if function == "get_config" {
+		config, err := t.retrieve_config(stub)
+																								if err != nil { return nil, err }
+		return json.Marshal(config)
+	} else if function == "list_functions" {
+		return json.Marshal(Function_List{Invoke: invoke_functions, Query: query_functions})
+	} else if function == "get_diamonds_grouped" {
+		return t.get_diamonds_grouped(stub, caller, caller_affiliation)
+	} else if function == "get_diamonds_by_owners" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_diamonds_by_owners(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_diamonds_by_owner_statuses" {
+		if len(args) != 2 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_diamonds_by_owner_statuses(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "refresh_role" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.refresh_role(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_stale_diamonds" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_stale_diamonds(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_orphaned_ownership" {
+		return t.get_orphaned_ownership(stub, caller, caller_affiliation)
+	} else if function == "get_incomplete_provenance" {
+		return t.get_incomplete_provenance(stub, caller, caller_affiliation)
+	} else if function == "get_total_transfers" {
+		count, err := t.retrieve_transfer_count(stub)
+																								if err != nil { return nil, err }
+		return []byte(strconv.Itoa(count)), nil
+	} else if function == "get_transfer_stats" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_transfer_stats(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_diamonds_by_creator_and_status" {
+		if len(args) != 2 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_diamonds_by_creator_and_status(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "export_snapshot" {
+		return t.export_snapshot(stub, caller, caller_affiliation)
+	} else if function == "export_jsonld" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.export_jsonld(stub, v, caller, caller_affiliation)
+	} else if function == "export_attestation" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.export_attestation(stub, v, caller, caller_affiliation)
+	} else if function == "verify_attestation" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return json.Marshal(t.verify_attestation(stub, args[0]))
+	} else if function == "verify_attestations_batch" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.verify_attestations_batch(stub, args[0])
+	} else if function == "get_jewellery_components" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_jewellery_components(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_status_history" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.get_status_history(stub, v, caller, caller_affiliation)
+	} else if function == "get_provenance_score" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.get_provenance_score(stub, v, caller, caller_affiliation)
+	} else if function == "get_unidentified_diamonds" {
+		return t.get_unidentified_diamonds(stub, caller, caller_affiliation)
+	} else if function == "get_diamonds_in_jewel_stage" {
+		return t.get_diamonds_in_jewel_stage(stub, caller, caller_affiliation)
+	} else if function == "get_diamonds_by_label" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_diamonds_by_label(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_transferable_to" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_transferable_to(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_historical_holdings" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_historical_holdings(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_activity_summary" {
+		if len(args) != 2 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_activity_summary(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "get_post_cert_grade_changes" {
+		return t.get_post_cert_grade_changes(stub, caller, caller_affiliation)
+	} else if function == "get_active_holders" {
+		return t.get_active_holders(stub, caller, caller_affiliation)
+	} else if function == "get_creation_counts_by_day" {
+		if len(args) != 2 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_creation_counts_by_day(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "get_schema_version" {
+		return json.Marshal(Schema_Info{SchemaVersion: SCHEMA_VERSION, MinSchemaVersion: MIN_SCHEMA_VERSION})
+	} else if function == "get_global_freeze" {
+		freeze, err := t.retrieve_freeze(stub)
+																								if err != nil { return nil, err }
+		return json.Marshal(freeze)
+	} else if function == "get_most_transferred" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_most_transferred(stub, caller, caller_affiliation, args[0])
+	} else if function == "detect_ownership_anomalies" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.detect_ownership_anomalies(stub, v, caller, caller_affiliation)
+	} else if function == "get_diamond_passport" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.get_diamond_passport(stub, v, caller, caller_affiliation)
+	} else if function == "get_diamonds_by_location" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_diamonds_by_location(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_diamond_qr_payload" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.get_diamond_qr_payload(stub, v, caller, caller_affiliation)
+	} else if function == "verify_qr_payload" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return json.Marshal(t.verify_qr_payload(stub, args[0]))
+	} else if function == "get_parcel_summary" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_parcel_summary(stub, caller, caller_affiliation, args[0])
+	} else if function == "get_grade_distribution" {
+		return t.get_grade_distribution(stub, caller, caller_affiliation)
+	} else if function == "get_rough_link" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.get_rough_link(stub, v, caller, caller_affiliation)
+	} else if function == "compare_diamonds" {
+		if len(args) != 2 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		a, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		b, err := t.retrieve_assetID(stub, args[1])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.compare_diamonds(stub, a, b, caller, caller_affiliation)
+	} else if function == "whoami" {
+		return json.Marshal(Caller_Identity{Username: caller, Affiliation: caller_affiliation, Issuer: caller_issuer(stub)})
+	} else if function == "get_diamonds_paged" {
+		if len(args) != 2 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		return t.get_diamonds_paged(stub, caller, caller_affiliation, args[0], args[1])
+	} else if function == "get_value_trend" {
+		if len(args) != 1 { return nil, invalid_error("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_assetID(stub, args[0])
+																								if err != nil { return nil, wrap_error("QUERY: Error retrieving assetID ", err) }
+		return t.get_value_trend(stub, v, caller, caller_affiliation)
+	}
+
+
+	
+
+	return nil, invalid_error("Received unknown function invocation" + function)
+
+}
+
+//=================================================================================================================================
+//	 Ping Function
+//=================================================================================================================================
+//	 Pings the peer to keep the connection alive
+//=================================================================================================================================
+func (t *SimpleChaincode) ping(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	return []byte("Hello, world!"), nil
+}
+
+//=================================================================================================================================
+//	 Create Function
+//=================================================================================================================================									
+//	 Create Diamond - Creates the initial JSON for the diamond and then saves it to the ledger.									
+//=================================================================================================================================
+func (t *SimpleChaincode) create_asset(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, assetID string) ([]byte, error) {								
+
+	if 	caller_affiliation != MINER {							// Only the Miner can create a new unique, checked before anything about the request is
+
+																	return nil, permission_error(fmt.Sprintf("Permission Denied. create_asset. %v === %v", caller_affiliation, MINER))
+	}
+
+	v := Asset{														// Built as a struct so nothing in the assetID or the caller`s name can
+		AssetID:       assetID,										// add fields to the record
+		Colour:        "UNDEFINED",
+		Diamondat:     "UNDEFINED",
+		Cut:           "UNDEFINED",
+		Clarity:       "UNDEFINED",
+		Location:      "UNDEFINED",
+		Origin:        "UNDEFINED",
+		Date:          "UNDEFINED",
+		Timestamp:     "UNDEFINED",
+		Polish:        "UNDEFINED",
+		Owner:         caller,
+		Symmetry:      "UNDEFINED",
+		Fluorescence:  "UNDEFINED",
+		GIACert:       "UNDEFINED",
+		JewelleryType: "UNDEFINED",
+		Status:        STATE_MINING,
+		Scrapped:      false,										// A new diamond always starts with the miner and can never be created already scrapped
+	}
+	
+	problems := []string{}												// Collect every problem with the request so they can all be fixed at once
+	
+	err := t.validate_asset_id(stub, assetID)  							// assetID must fit the configured format, by default two letters followed by seven digits
+	
+												if err != nil { problems = append(problems, err.Error()) }
+
+	record, err := stub.GetState(assetID) 								// If not an error then a record exists so cant create a new Diamond with this assets_id as it must be unique
+	
+												if err != nil { fmt.Printf("CREATE_ASSET: Error retrieving asset: %s", err); return nil, errors.New("Error retrieving asset") }
+												if record != nil { problems = append(problems, "Asset already exists") }
+	
+												if len(problems) > 0 { fmt.Printf("CREATE_ASSET: %v", problems); return nil, validation_error(problems) }
+
+	v.PaymentStatus = PAYMENT_UNPAID
+	v.SchemaVersion = SCHEMA_VERSION
+	
+	err = t.change_status(stub, &v, STATE_MINING, caller, true)
+	
+																		if err != nil { fmt.Printf("CREATE_ASSET: Error recording status: %s", err); return nil, errors.New("Error recording status") }
+	v.Creator       = caller												// Kept for good, unlike Owner which changes with every transfer
+	
+	v.CreatedAt, err = t.get_tx_time(stub)
+	
+																		if err != nil { fmt.Printf("CREATE_ASSET: %s", err); return nil, err }
+	
+	err = t.append_ownership(stub, &v, "", caller, caller_affiliation)
+	
+																		if err != nil { fmt.Printf("CREATE_ASSET: Error recording ownership: %s", err); return nil, errors.New("Error recording ownership") }
+	
+	assetIDs, err := t.retrieve_asset_ids(stub)							// Read the index before writing anything so a corrupt index stops the create up front
+	
+																		if err != nil { fmt.Printf("CREATE_ASSET: %s", err); return nil, err }
+	
+	config, err := t.retrieve_config(stub)
+	
+																		if err != nil { fmt.Printf("CREATE_ASSET: %s", err); return nil, err }
+	
+	if len(assetIDs.AssetIDs) >= config.MaxAssets {
+																		return nil, invalid_error("Invalid create, the asset index is full at " + strconv.Itoa(config.MaxAssets) + " diamonds")
+	}
+	
+	err = t.count_create(stub, caller, config)							// Stops a compromised miner key from flooding the ledger
+	
+																		if err != nil { fmt.Printf("CREATE_ASSET: %s", err); return nil, err }
+															
+	assetIDs.AssetIDs = append(assetIDs.AssetIDs, assetID)
+	
+	err = t.save_asset_ids(stub, assetIDs)								// Index first then the diamond. Either write failing returns an error, which
+																		// discards both writes with the transaction, so a diamond is never left unindexed
+																		if err != nil { fmt.Printf("CREATE_ASSET: %s", err); return nil, err }
+	
+	_, err  = t.save_changes(stub, v)									
+			
+																		if err != nil { fmt.Printf("CREATE_DIAMOND: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 import_asset_ids - Merges a list of assetIDs carried over from a previous chaincode into the index. IDs already in
+//						the index or repeated in the list are only added once. Every ID must already have a diamond record
+//						on the ledger and the merged index cannot grow past MaxAssets. Only the Miner can import.
+//=================================================================================================================================
+func (t *SimpleChaincode) import_asset_ids(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, ids_json string) ([]byte, error) {
+
+	if caller_affiliation != MINER {
+																		return nil, permission_error("Permission denied. import_asset_ids")
+	}
+
+	var imported []string
+
+	err := json.Unmarshal([]byte(ids_json), &imported)
+
+																		if err != nil { return nil, invalid_error("Invalid assetID list, expected a JSON array of strings") }
+
+	for _, assetID := range imported {
+
+		err = t.validate_asset_id(stub, assetID)
+
+																		if err != nil { return nil, err }
+
+		record, err := stub.GetState(assetID)
+
+																		if err != nil { return nil, errors.New("Error checking assetID " + assetID) }
+																		if record == nil { return nil, not_found_error("Invalid import, no diamond record found with assetID = " + assetID) }
+	}
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																		if err != nil { return nil, err }
+
+	seen := make(map[string]bool)
+
+	var merged []string
+
+	for _, assetID := range append(assetIDs.AssetIDs, imported...) {
+
+		if seen[assetID] { continue }
+
+		seen[assetID] = true
+		merged = append(merged, assetID)
+	}
+
+	config, err := t.retrieve_config(stub)
+
+																		if err != nil { return nil, err }
+
+	if len(merged) > config.MaxAssets {
+																		return nil, invalid_error("Invalid import, the asset index would hold " + strconv.Itoa(len(merged)) + " diamonds which is more than the limit of " + strconv.Itoa(config.MaxAssets))
+	}
+
+	assetIDs.AssetIDs = merged
+
+	err = t.save_asset_ids(stub, assetIDs)
+
+																		if err != nil { return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 mint_diamond - Creates a diamond with an assetID generated by the chaincode. The ID is the two letter prefix passed
+//					followed by seven digits taken from a hash of the transaction ID, so a retried transaction always
+//					mints the same ID. If that ID is taken the hash is repeated with a counter until a free one is found.
+//					Returns the minted assetID.
+//=================================================================================================================================
+func (t *SimpleChaincode) mint_diamond(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, prefix string) ([]byte, error) {
+
+	matched, err := regexp.MatchString("^[A-Za-z]{2}$", prefix)
+
+																		if err != nil || matched == false { return nil, invalid_error("Invalid prefix, expected two letters") }
+
+	for attempt := 0; attempt < 100; attempt++ {
+
+		sum := sha256.Sum256([]byte(stub.GetTxID() + ":" + strconv.Itoa(attempt)))
+
+		assetID := fmt.Sprintf("%s%07d", prefix, binary.BigEndian.Uint64(sum[:8]) % 10000000)
+
+		record, err := stub.GetState(assetID)
+
+																		if err != nil { return nil, errors.New("Error checking assetID " + assetID) }
+
+		if record != nil { continue }
+
+		_, err = t.create_asset(stub, caller, caller_affiliation, assetID)
+
+																		if err != nil { return nil, err }
+
+		return []byte(assetID), nil
+	}
+
+																		return nil, errors.New("Unable to mint a unique assetID")
+}
+
+//=================================================================================================================================
+//	 Transfer Functions
+//=================================================================================================================================
+//	 complete_transfer - Finishes a transfer once the transfer function has checked it is allowed and changed the owner.
+//						 The history entry is added to the local copy of the diamond only, so it reaches the ledger with
+//						 the diamond when save_changes succeeds and not at all if it fails. The hash of the shipment`s
+//						 paperwork is kept on the entry when one is passed.
+//=================================================================================================================================
+func (t *SimpleChaincode) complete_transfer(stub  shim.ChaincodeStubInterface, v Asset, caller string, recipient_name string, recipient_affiliation string, doc_hash string) ([]byte, error) {
+
+	err := t.append_ownership(stub, &v, caller, recipient_name, recipient_affiliation)
+
+															if err != nil { fmt.Printf("COMPLETE_TRANSFER: Error recording ownership: %s", err); return nil, errors.New("Error recording ownership") }
+
+	if doc_hash != "" { v.OwnershipHistory[len(v.OwnershipHistory)-1].DocumentHash = doc_hash }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("COMPLETE_TRANSFER: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	err = t.increment_transfer_count(stub)					// Only counted once the transfer itself has been saved
+
+															if err != nil { fmt.Printf("COMPLETE_TRANSFER: Error counting transfer: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 transfer - Moves a diamond along the edge named in transfer_edges, handing custody to the new owner as well.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, edge_name string, recipient_name string) ([]byte, error) {
+
+	return t.move_along_edge(stub, v, caller, caller_affiliation, edge_name, recipient_name, false, "")
+}
+
+//=================================================================================================================================
+//	 move_along_edge - Moves a diamond along the edge named in transfer_edges. The caller must own the diamond, hold the
+//					   edge`s from role and the diamond must be in the edge`s required status with its required fields
+//					   set. The diamond then passes to the recipient in the edge`s next status. The custodian is cleared
+//					   unless keep_custodian is set, for stones whose custody lags behind ownership. doc_hash, when not
+//					   empty, is recorded on the new ownership history entry.
+//=================================================================================================================================
+func (t *SimpleChaincode) move_along_edge(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, edge_name string, recipient_name string, keep_custodian bool, doc_hash string) ([]byte, error) {
+
+	edge, ok := transfer_edges[edge_name]
+
+																if !ok { return nil, invalid_error("Unknown transfer " + edge_name) }
+
+	if edge.RequiresPaid && v.PaymentStatus != PAYMENT_PAID {
+																return nil, invalid_error("Invalid transfer, the diamond must be paid for before " + edge_name)
+	}
+
+	if edge.RequiresKPCert && !is_undefined(v.Origin) && v.KPCertNumber == "" {
+																return nil, invalid_error("Invalid transfer, a Kimberley Process certificate must be set before " + edge_name)
+	}
+
+	for _, field := range edge.RequiredFields {
+		if is_undefined(field_value(v, field)) {
+																return nil, invalid_error("Invalid transfer, " + field + " must be set before " + edge_name)
+		}
+	}
+
+	if 		v.Status				== edge.RequiredStatus	&&
+			v.Owner					== caller				&&
+			caller_affiliation		== edge.From			{
+
+					v.Owner  = recipient_name
+
+					err := t.change_status(stub, &v, edge.NextStatus, caller, false)
+
+																if err != nil { fmt.Printf("TRANSFER: Error recording status: %s", err); return nil, errors.New("Error recording status") }
+
+					if !keep_custodian { v.Custodian = "" }
+
+	} else {
+																fmt.Printf("TRANSFER: Permission denied for %s", edge_name)
+																return nil, permission_error("Permission denied")
+	}
+
+	return t.complete_transfer(stub, v, caller, recipient_name, edge.To, doc_hash)
+}
+
+//=================================================================================================================================
+//	 status_for_affiliation - Returns the status a diamond is in while it is held by the affiliation passed, worked out
+//							  from the transfer edge that delivers diamonds to that affiliation.
+//=================================================================================================================================
+func status_for_affiliation(affiliation string) (int, error) {
+
+	if affiliation == MINER { return STATE_MINING, nil }
+
+	for _, edge := range transfer_edges {
+		if edge.To == affiliation { return edge.NextStatus, nil }
+	}
+
+	return 0, invalid_error("Invalid affiliation " + affiliation + ", no status holds diamonds for it")
+}
+
+//=================================================================================================================================
+//	 admin_transfer - Reassigns the diamond to any participant for exceptional cases such as a court order or an
+//					  inheritance, skipping the normal transfer edges. Only the Miner can do this and a reason must be
+//					  given. The status is set to match the new owner`s affiliation and the Miner and reason are kept
+//					  on the ownership record.
+//=================================================================================================================================
+func (t *SimpleChaincode) admin_transfer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_owner string, new_owner_affiliation string, reason string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		{
+																return nil, permission_error("Permission denied. admin_transfer")
+	}
+
+	if strings.TrimSpace(reason) == "" {
+																return nil, invalid_error("Invalid admin transfer, a reason must be given")
+	}
+
+	if strings.TrimSpace(new_owner) == "" {
+																return nil, invalid_error("Invalid admin transfer, the new owner cannot be empty")
+	}
+
+	if v.Scrapped { return nil, invalid_error("Diamond is scrapped; no further transfers allowed") }
+
+	status, err := status_for_affiliation(new_owner_affiliation)
+
+																if err != nil { return nil, err }
+
+	err = t.append_ownership(stub, &v, v.Owner, new_owner, new_owner_affiliation)
+
+																if err != nil { fmt.Printf("ADMIN_TRANSFER: Error recording ownership: %s", err); return nil, errors.New("Error recording ownership") }
+
+	v.OwnershipHistory[len(v.OwnershipHistory)-1].AuthorizedBy = caller
+	v.OwnershipHistory[len(v.OwnershipHistory)-1].Reason       = reason
+
+	v.Owner     = new_owner
+	v.Custodian = ""
+
+	err = t.change_status(stub, &v, status, caller, false)
+
+																if err != nil { fmt.Printf("ADMIN_TRANSFER: Error recording status: %s", err); return nil, errors.New("Error recording status") }
+
+	_, err = t.save_changes(stub, v)
+
+																if err != nil { fmt.Printf("ADMIN_TRANSFER: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	err = t.increment_transfer_count(stub)
+
+																if err != nil { fmt.Printf("ADMIN_TRANSFER: Error counting transfer: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 dispatch_transfer - Performs the transfer named. Kept so the functions that take a transfer type by name don`t need
+//						 to know about the edge table.
+//=================================================================================================================================
+func (t *SimpleChaincode) dispatch_transfer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, transfer_type string, recipient_name string) ([]byte, error) {
+
+	if _, ok := transfer_edges[transfer_type]; !ok {
+																return nil, invalid_error("Function of that name doesn`t exist.")
+	}
+
+	return t.transfer(stub, v, caller, caller_affiliation, transfer_type, recipient_name)
+}
+
+//=================================================================================================================================
+//	 transfer_with_document - Performs the transfer named and records the hash of the paperwork that came with the
+//							  shipment against the new ownership history entry.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer_with_document(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, transfer_type string, doc_hash string) ([]byte, error) {
+
+	err := validate_sha256(doc_hash)
+
+																if err != nil { return nil, invalid_error("Invalid document hash, expected 64 hex characters of SHA-256") }
+
+	if _, ok := transfer_edges[transfer_type]; !ok {
+																return nil, invalid_error("Function of that name doesn`t exist.")
+	}
+
+	return t.move_along_edge(stub, v, caller, caller_affiliation, transfer_type, recipient_name, false, strings.ToLower(doc_hash))		// The hash goes in with the transfer`s own save
+}
+
+//=================================================================================================================================
+//	 transfer_to_verified - Transfers the diamond as transfer_type only if the Miner has verified the recipient`s identity.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer_to_verified(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, transfer_type string) ([]byte, error) {
+
+	verified, err := t.retrieve_verified(stub)
+
+																if err != nil { return nil, err }
+
+	if !verified[recipient_name] { return nil, invalid_error("Invalid transfer, recipient " + recipient_name + " has not been verified") }
+
+	return t.dispatch_transfer(stub, v, caller, caller_affiliation, transfer_type, recipient_name)
+}
+
+//=================================================================================================================================
+//	 miner_to_distributor
+//=================================================================================================================================
+func (t *SimpleChaincode) miner_to_distributor(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "miner_to_distributor", recipient_name)
+
+}
+
+//=================================================================================================================================
+//	 distributor_to_dealer
+//=================================================================================================================================
+func (t *SimpleChaincode) distributor_to_dealership(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "distributor_to_dealership", recipient_name)
+
+}
+
+//=================================================================================================================================
+//	 distribute_and_transfer - Applies a set of grades and hands the diamond on to the dealership in a single invoke. The
+//							   grades are only written if every one of them is valid and the transfer is allowed.
+//=================================================================================================================================
+func (t *SimpleChaincode) distribute_and_transfer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, grading_json string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	var grades map[string]string
+
+	err := json.Unmarshal([]byte(grading_json), &grades)
+
+															if err != nil { return nil, invalid_error("Invalid grading JSON, expected an object of field to grade") }
+
+	if v.Owner != caller {
+															return nil, permission_error("Permission denied")
+	}
+
+	problems := t.grade_problems(stub, v, grades)
+
+															if len(problems) > 0 { fmt.Printf("DISTRIBUTE_AND_TRANSFER: %v", problems); return nil, validation_error(problems) }
+
+	var fields []string
+
+	for field := range grades { fields = append(fields, field) }
+
+	sort.Strings(fields)												// Map order differs between peers, the grading history must not
+
+	for _, field := range fields {
+
+		err = t.apply_grade(stub, &v, field, grades[field], caller)
+
+															if err != nil { fmt.Printf("DISTRIBUTE_AND_TRANSFER: %s", err); return nil, err }
+	}
+
+	return t.distributor_to_dealership(stub, v, caller, caller_affiliation, recipient_name, recipient_affiliation)
+}
+
+//=================================================================================================================================
+//	 dealership_to_buyer
+//=================================================================================================================================
+func (t *SimpleChaincode) dealership_to_buyer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "dealership_to_buyer", recipient_name)
+
+}
+
+//=================================================================================================================================
+//	 buyer_to_trader
+//=================================================================================================================================
+func (t *SimpleChaincode) buyer_to_trader(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "buyer_to_trader", recipient_name)
+
+}
+
+//=================================================================================================================================
+//	 trader_to_cutter
+//=================================================================================================================================
+func (t *SimpleChaincode) trader_to_cutter(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "trader_to_cutter", recipient_name)
+
+}
+
+//=================================================================================================================================
+//	 cutter_to_jewellery_maker
+//=================================================================================================================================
+func (t *SimpleChaincode) cutter_to_jewellery_maker(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "cutter_to_jewellery_maker", recipient_name)
+
+}
+//=================================================================================================================================
+//	 jewellery_maker_to_customer
+//=================================================================================================================================
+func (t *SimpleChaincode) jewellery_maker_to_customer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+
+	return t.transfer(stub, v, caller, caller_affiliation, "jewellery_maker_to_customer", recipient_name)
+
+}
+
+
+
+//=================================================================================================================================
+//	 scrap_asset - Marks the diamond as scrapped. Can be done by the current owner or the Miner, and only once. The SHA-256
+//				   hash of a destruction certificate can optionally be given, it is kept on the diamond and on the status
+//				   change into being_scrapped.
+//=================================================================================================================================
+func (t *SimpleChaincode) scrap_asset(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, cert_hash string) ([]byte, error) {
+
+	if		v.Scrapped			== true			{
+															return nil, invalid_error("Asset is already scrapped")
+	}
+
+	if cert_hash != "" {
+
+		err := validate_sha256(cert_hash)
+
+															if err != nil { return nil, invalid_error("Invalid destruction certificate hash, expected 64 hex characters of SHA-256") }
+
+		cert_hash = strings.ToLower(cert_hash)
+	}
+
+	if		v.Owner				== caller		||
+			caller_affiliation	== MINER		{
+
+					err := t.change_status(stub, &v, STATE_BEING_SCRAPPED, caller, false)
+
+															if err != nil { fmt.Printf("SCRAP_ASSET: Error recording status: %s", err); return nil, errors.New("Error recording status") }
+
+					v.Scrapped        = true
+					v.WriteOffPending = false							// Scrapping settles any write off still waiting for approval
+
+					if cert_hash != "" {
+						v.DestructionCertHash = cert_hash
+						v.StatusHistory[len(v.StatusHistory)-1].CertHash = cert_hash
+					}
+
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SCRAP_ASSET: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 customer_write_off - Lets the customer who owns a diamond ask for it to be written off, for example for an insurance
+//						  claim. The diamond isn't scrapped until the Miner approves the request with approve_write_off.
+//=================================================================================================================================
+func (t *SimpleChaincode) customer_write_off(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, reason string) ([]byte, error) {
+
+	if		v.Scrapped			== true			{
+															return nil, invalid_error("Asset is already scrapped")
+	}
+
+	if strings.TrimSpace(reason) == "" {
+															return nil, invalid_error("Invalid write off, a reason is required")
+	}
+
+	if		v.Owner				== caller		&&
+			caller_affiliation	== CUSTOMER		{
+
+					v.WriteOffPending = true
+					v.WriteOffReason  = reason
+
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("CUSTOMER_WRITE_OFF: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 approve_write_off - Scraps a diamond with a pending write off, keeping the customer`s reason as the scrap reason. Only
+//						 the Miner can approve.
+//=================================================================================================================================
+func (t *SimpleChaincode) approve_write_off(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied")
+	}
+
+	if		v.Scrapped			== true			{
+															return nil, invalid_error("Asset is already scrapped")
+	}
+
+	if		v.WriteOffPending	== false		{
+															return nil, invalid_error("Invalid approval, no write off is pending for asset " + v.AssetID)
+	}
+
+	err := t.change_status(stub, &v, STATE_BEING_SCRAPPED, caller, false)
+
+															if err != nil { fmt.Printf("APPROVE_WRITE_OFF: Error recording status: %s", err); return nil, errors.New("Error recording status") }
+
+	v.WriteOffPending = false
+	v.Scrapped        = true
+	v.ScrapReason     = v.WriteOffReason
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("APPROVE_WRITE_OFF: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 record_inspection - Records the grades an inspector found on the physical stone and compares them with the grades on
+//						 record. The inspection is kept in the inspection history and the comparison is returned.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_inspection(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, inspection_json string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		&&
+			caller_affiliation	!= INSPECTOR	{
+															return nil, permission_error("Permission denied. record_inspection")
+	}
+
+	var grades map[string]string
+
+	err := json.Unmarshal([]byte(inspection_json), &grades)
+
+															if err != nil || len(grades) == 0 { return nil, invalid_error("Invalid inspection JSON, expected an object of field to grade") }
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	inspection := Inspection_Record{Inspector: caller, Timestamp: timestamp, Grades: grades, Mismatches: []string{}}
+
+	for field, value := range grades {
+
+		if _, ok := default_grade_vocabularies[field]; !ok { return nil, invalid_error("Unknown grading field " + field) }
+
+		if normalize_value(grade_value(v, field)) != normalize_value(value) {		// Stray whitespace or the case of UNDEFINED isn`t a mismatch
+			inspection.Mismatches = append(inspection.Mismatches, field)
+		}
+	}
+
+	sort.Strings(inspection.Mismatches)
+
+	inspection.Match = len(inspection.Mismatches) == 0
+
+	v.InspectionHistory = append(v.InspectionHistory, inspection)
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RECORD_INSPECTION: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return json.Marshal(inspection)
+
+}
+
+//=================================================================================================================================
+//	 update_cut
+//=================================================================================================================================
+func (t *SimpleChaincode) update_cut(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+			
+					err := t.apply_grade(stub, &v, "cut", new_value, caller)
+
+														if err != nil { fmt.Printf("UPDATE_CUT: %s", err); return nil, err }
+	
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("UPDATE_CUT: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+
+//=================================================================================================================================
+//	 update_colour
+//=================================================================================================================================
+func (t *SimpleChaincode) update_colour(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+			
+					err := t.apply_grade(stub, &v, "colour", new_value, caller)
+
+														if err != nil { fmt.Printf("UPDATE_COLOUR: %s", err); return nil, err }
+	
+	} else {
+															return nil, permission_error(fmt.Sprintf("Permission denied. update_colour, %s is not the owner of %s", caller, v.AssetID))
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("update_colour: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+
+
+
+//=================================================================================================================================
+//	 update_clarity
+//=================================================================================================================================
+func (t *SimpleChaincode) update_clarity(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if 		v.Owner				== caller		{
+			
+					err := t.apply_grade(stub, &v, "clarity", new_value, caller)
+
+														if err != nil { fmt.Printf("UPDATE_CLARITY: %s", err); return nil, err }
+	} else {
+	
+															return nil, permission_error("Permission denied")
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("UPDATE_CLARITY: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+//=================================================================================================================================
+//	 update_diamondat - The Diamondat is assigned by the Distributor, so it can only be set while the diamond is being
+//						distributed. miner_to_distributor moves the diamond into that state. Diamondats are unique across
+//						all diamonds, which is enforced through an index of Diamondat to assetID.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_diamondat(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+	
+	if		v.Status			!= STATE_DISTRIBUTING	{
+															return nil, invalid_error("Invalid update, Diamondat can only be set while the diamond is " + status_labels[STATE_DISTRIBUTING])
+	}
+	
+	if 		v.Owner				!= caller		{
+															return nil, permission_error("Permission denied")
+	}
+	
+	new_value = normalize_value(new_value)
+	
+	err := validate_diamondat(new_value)
+	
+															if err != nil { return nil, err }
+	
+	if v.Diamondat == new_value { return nil, nil }			// Already assigned to this diamond, nothing to do
+	
+	claimed, err := stub.GetState(DIAMONDAT_INDEX_PREFIX + new_value)
+	
+															if err != nil { fmt.Printf("UPDATE_DiamondAT: Error retrieving diamondat index: %s", err); return nil, errors.New("Error retrieving diamondat index") }
+	
+	if claimed != nil && string(claimed) != v.AssetID {
+															return nil, invalid_error("Diamondat " + new_value + " already exists on asset " + string(claimed))
+	}
+	
+	if !is_undefined(v.Diamondat) {
+	
+		err = stub.DelState(DIAMONDAT_INDEX_PREFIX + v.Diamondat)
+	
+															if err != nil { fmt.Printf("UPDATE_DiamondAT: Error removing old diamondat index: %s", err); return nil, errors.New("Error updating diamondat index") }
+	}
+	
+	err = stub.PutState(DIAMONDAT_INDEX_PREFIX + new_value, []byte(v.AssetID))
+	
+															if err != nil { fmt.Printf("UPDATE_DiamondAT: Error storing diamondat index: %s", err); return nil, errors.New("Error updating diamondat index") }
+	
+	v.Diamondat = new_value
+	
+	_, err = t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("UPDATE_DiamondAT: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+//=================================================================================================================================
+//	 update_SYMMETRY
+//=================================================================================================================================
+func (t *SimpleChaincode) update_symmetry(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if 		v.Owner				== caller		{
+			
+					err := t.apply_grade(stub, &v, "symmetry", new_value, caller)
+
+														if err != nil { fmt.Printf("UPDATE_SYMMETRY: %s", err); return nil, err }
+					
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("UPDATE_SYMMETRY: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+//=================================================================================================================================
+//	 update_POLISH
+//=================================================================================================================================
+func (t *SimpleChaincode) update_polish(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+			err := t.apply_grade(stub, &v, "polish", new_value, caller)
+
+														if err != nil { fmt.Printf("UPDATE_POLISH: %s", err); return nil, err }
+					
+	} else {
+		return nil, permission_error(fmt.Sprintf("Permission denied. update_polish, %s is not the owner of %s", caller, v.AssetID))
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("UPDATE_POLISH: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+//=================================================================================================================================
+//	 update_fluorescence
+//=================================================================================================================================
+func (t *SimpleChaincode) update_fluorescence(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+
+					err := t.apply_grade(stub, &v, "fluorescence", new_value, caller)
+
+														if err != nil { fmt.Printf("UPDATE_FLUORESCENCE: %s", err); return nil, err }
+
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_FLUORESCENCE: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 update_date
+//=================================================================================================================================
+func (t *SimpleChaincode) update_date(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+			v.Date=new_value
+					
+	} else {
+		return nil, permission_error("Permission denied")
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+//=================================================================================================================================
+//	 update_timestamp 
+//=================================================================================================================================
+func (t *SimpleChaincode) update_timestamp(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+			v.Date=new_value
+					
+	} else {
+		return nil, permission_error("Permission denied")
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+//=================================================================================================================================
+//	 update_jewellerytype
+//=================================================================================================================================
+func (t *SimpleChaincode) update_jewellerytype(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+			v.JewelleryType=new_value
+					
+	} else {
+		return nil, permission_error("Permission denied")
+	}
+	
+	_, err := t.save_changes(stub, v)
+	
+															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	
+	return nil, nil
+	
+}
+
+
+
+//=================================================================================================================================
+//	 batch_update_grade - Applies the same grade to every diamond listed. Diamonds the caller doesn't own are skipped and
+//						  reported in the results rather than failing the whole batch.
+//=================================================================================================================================
+func (t *SimpleChaincode) batch_update_grade(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, field string, new_value string, ids_json string) ([]byte, error) {
+
+	err := t.validate_grade(stub, field, new_value)
+
+															if err != nil { fmt.Printf("BATCH_UPDATE_GRADE: %s", err); return nil, err }
+
+	var assetIDs []string
+
+	err = json.Unmarshal([]byte(ids_json), &assetIDs)
+
+															if err != nil { return nil, invalid_error("Invalid assetID list, expected a JSON array of strings") }
+
+	config, err := t.retrieve_config(stub)
+
+															if err != nil { return nil, err }
+
+	if len(assetIDs) > config.MaxBatch {
+															return nil, invalid_error("Invalid batch, no more than " + strconv.Itoa(config.MaxBatch) + " assetIDs allowed")
+	}
+
+	results := []Batch_Result{}
+
+	for _, assetID := range assetIDs {
+
+		result := Batch_Result{AssetID: assetID}
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil {
+			result.Error = "Error retrieving assetID"
+		} else if v.Owner != caller {
+			result.Error = "Permission denied"
+		} else if err = check_updatable(v); err != nil {
+			result.Error = err.Error()
+		} else if err = t.apply_grade(stub, &v, field, new_value, caller); err != nil {
+			result.Error = err.Error()
+		} else {
+			_, err = t.save_changes(stub, v)
+
+			if err != nil { result.Error = "Error saving changes: " + err.Error() } else { result.Success = true }
+		}
+
+		results = append(results, result)
+	}
+
+	return json.Marshal(results)
+}
+
+//=================================================================================================================================
+//	 restore_index - Points the index key passed at the diamond, refusing if another diamond already holds it. Nothing
+//					 is written when check_only is set. Undefined values aren`t indexed.
+//=================================================================================================================================
+func restore_index(stub  shim.ChaincodeStubInterface, prefix string, value string, assetID string, check_only bool) error {
+
+	if is_undefined(value) { return nil }
+
+	claimed, err := stub.GetState(prefix + value)
+
+															if err != nil { return errors.New("Error retrieving index " + prefix + value) }
+
+	if claimed != nil && string(claimed) != assetID { return invalid_error(value + " already exists on asset " + string(claimed)) }
+
+	if check_only { return nil }
+
+	err = stub.PutState(prefix + value, []byte(assetID))
+
+															if err != nil { return errors.New("Error storing index " + prefix + value) }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 release_index - Removes the index key passed if it points at the diamond. Keys held by another diamond are left alone.
+//=================================================================================================================================
+func release_index(stub  shim.ChaincodeStubInterface, prefix string, value string, assetID string) error {
+
+	if is_undefined(value) { return nil }
+
+	claimed, err := stub.GetState(prefix + value)
+
+															if err != nil { return errors.New("Error retrieving index " + prefix + value) }
+
+	if string(claimed) != assetID { return nil }
+
+	err = stub.DelState(prefix + value)
+
+															if err != nil { return errors.New("Error removing index " + prefix + value) }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 import_snapshot - Restores the diamonds in a snapshot made by export_snapshot and adds them to the asset index. Each
+//					   record is checked and imported on its own and a result is returned for each. Diamonds already on
+//					   the ledger are only overwritten when force is set, and the index entries of the record being
+//					   replaced are released first. The asset index cannot grow past MaxAssets. Only the Miner can import.
+//=================================================================================================================================
+func (t *SimpleChaincode) import_snapshot(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, snapshot_json string, force bool) ([]byte, error) {
+
+	if caller_affiliation != MINER {
+															return nil, permission_error("Permission denied. import_snapshot")
+	}
+
+	var snapshot Snapshot
+
+	err := json.Unmarshal([]byte(snapshot_json), &snapshot)
+
+															if err != nil { return nil, invalid_error("Invalid snapshot JSON") }
+
+	if len(snapshot.Diamonds) > MAX_SNAPSHOT {
+															return nil, invalid_error("Invalid snapshot, no more than " + strconv.Itoa(MAX_SNAPSHOT) + " diamonds allowed")
+	}
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+															if err != nil { return nil, err }
+
+	config, err := t.retrieve_config(stub)
+
+															if err != nil { return nil, err }
+
+	indexed := make(map[string]bool)
+
+	for _, assetID := range assetIDs.AssetIDs { indexed[assetID] = true }
+
+	results := []Batch_Result{}
+
+	for _, v := range snapshot.Diamonds {
+
+		migrate_asset(&v)													// Snapshots taken by older code hold older record layouts
+
+		result := Batch_Result{AssetID: v.AssetID}
+
+		var previous Asset													// The record being overwritten, empty when there is none
+
+		existing, err := stub.GetState(v.AssetID)
+
+		if err != nil {
+			result.Error = "Error retrieving asset"
+		} else if existing != nil && !force {
+			result.Error = "Asset already exists, set force to overwrite it"
+		} else if existing != nil && json.Unmarshal(existing, &previous) != nil {
+			result.Error = "Corrupt asset record " + v.AssetID
+		} else if !indexed[v.AssetID] && len(assetIDs.AssetIDs) >= config.MaxAssets {
+			result.Error = "Invalid import, the asset index is full at " + strconv.Itoa(config.MaxAssets) + " diamonds"
+		} else if err = t.validate_asset_id(stub, v.AssetID); err != nil {
+			result.Error = err.Error()
+		} else if _, ok := status_labels[v.Status]; !ok {
+			result.Error = "Invalid status " + strconv.Itoa(v.Status)
+		} else if err = restore_index(stub, GIA_INDEX_PREFIX, v.GIACert, v.AssetID, true); err != nil {		// Every check is made before anything is written so a
+			result.Error = err.Error()																	// rejected record leaves nothing behind
+		} else if err = restore_index(stub, DIAMONDAT_INDEX_PREFIX, v.Diamondat, v.AssetID, true); err != nil {
+			result.Error = err.Error()
+		} else if _, err = t.save_changes(stub, v); err != nil {						// save_changes enforces the remaining record invariants
+			result.Error = err.Error()
+		} else if err = release_index(stub, GIA_INDEX_PREFIX, previous.GIACert, v.AssetID); err != nil {
+			return nil, err
+		} else if err = release_index(stub, DIAMONDAT_INDEX_PREFIX, previous.Diamondat, v.AssetID); err != nil {
+			return nil, err
+		} else if err = restore_index(stub, GIA_INDEX_PREFIX, v.GIACert, v.AssetID, false); err != nil {
+			return nil, err
+		} else if err = restore_index(stub, DIAMONDAT_INDEX_PREFIX, v.Diamondat, v.AssetID, false); err != nil {
+			return nil, err
+		} else {
+			result.Success = true
+
+			if !indexed[v.AssetID] {
+				assetIDs.AssetIDs = append(assetIDs.AssetIDs, v.AssetID)
+				indexed[v.AssetID] = true
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	err = t.save_asset_ids(stub, assetIDs)
+
+															if err != nil { return nil, err }
+
+	return json.Marshal(results)
+}
+
+//=================================================================================================================================
+//	 create_jewellery - Sets the diamonds listed into a new piece of jewellery. Only a Jewellery Maker can do this and
+//						they must own every diamond, none of which can be scrapped or already set in another piece.
+//=================================================================================================================================
+func (t *SimpleChaincode) create_jewellery(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, jewelleryID string, components_json string) ([]byte, error) {
+
+	if caller_affiliation != JEWELLERYMAKER {
+															return nil, permission_error("Permission denied. create_jewellery")
+	}
+
+	if strings.TrimSpace(jewelleryID) == "" { return nil, invalid_error("Invalid jewellery ID, cannot be empty") }
+
+	existing, err := stub.GetState(JEWELLERY_PREFIX + jewelleryID)
+
+															if err != nil { fmt.Printf("CREATE_JEWELLERY: Error retrieving jewellery: %s", err); return nil, errors.New("Error retrieving jewellery") }
+
+	if existing != nil { return nil, invalid_error("Jewellery " + jewelleryID + " already exists") }
+
+	var assetIDs []string
+
+	err = json.Unmarshal([]byte(components_json), &assetIDs)
+
+															if err != nil || len(assetIDs) == 0 { return nil, invalid_error("Invalid component list, expected a JSON array of assetIDs") }
+
+	seen := make(map[string]bool)
+
+	var components []Asset
+
+	for _, assetID := range assetIDs {
+
+		if seen[assetID] { return nil, invalid_error("Invalid component list, " + assetID + " is listed more than once") }
+
+		seen[assetID] = true
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+															if err != nil { return nil, wrap_error("Error retrieving assetID: ", err) }
+
+		if v.Owner != caller { return nil, permission_error("Permission denied. create_jewellery, " + assetID + " is not owned by the caller") }
+
+		err = check_updatable(v)
+
+															if err != nil { return nil, err }
+
+		if v.JewelleryID != "" { return nil, invalid_error("Asset " + assetID + " is already set in jewellery " + v.JewelleryID) }
+
+		components = append(components, v)
+	}
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	bytes, err := json.Marshal(Jewellery_Item{JewelleryID: jewelleryID, Maker: caller, Components: assetIDs, Timestamp: timestamp})
+
+															if err != nil { return nil, errors.New("Error converting jewellery record") }
+
+	err = stub.PutState(JEWELLERY_PREFIX + jewelleryID, bytes)
+
+															if err != nil { fmt.Printf("CREATE_JEWELLERY: Error storing jewellery: %s", err); return nil, errors.New("Error storing jewellery") }
+
+	for _, v := range components {
+
+		v.JewelleryID = jewelleryID
+
+		_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("CREATE_JEWELLERY: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+	}
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 retrieve_jewellery - Reads the piece of jewellery stored under the ID passed.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_jewellery(stub  shim.ChaincodeStubInterface, jewelleryID string) (Jewellery_Item, error) {
+
+	var item Jewellery_Item
+
+	bytes, err := stub.GetState(JEWELLERY_PREFIX + jewelleryID)
+
+															if err != nil { return item, errors.New("Error retrieving jewellery") }
+
+	if bytes == nil { return item, not_found_error("Jewellery not found with jewelleryID = " + jewelleryID) }
+
+	err = json.Unmarshal(bytes, &item)
+
+															if err != nil { return item, errors.New("Corrupt jewellery record") }
+
+	return item, nil
+}
+
+//=================================================================================================================================
+//	 scrap_jewellery - Scraps a destroyed piece of jewellery along with every diamond set in it. The Miner can scrap any
+//					   piece, anyone else must own all of its diamonds. Each diamond goes through scrap_asset, so a
+//					   diamond that can`t be scrapped stops the whole piece. Diamonds already scrapped are left as they are.
+//=================================================================================================================================
+func (t *SimpleChaincode) scrap_jewellery(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, jewelleryID string) ([]byte, error) {
+
+	item, err := t.retrieve_jewellery(stub, jewelleryID)
+
+															if err != nil { return nil, err }
+
+	if item.Scrapped { return nil, invalid_error("Jewellery " + jewelleryID + " is already scrapped") }
+
+	var components []Asset
+
+	for _, assetID := range item.Components {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+															if err != nil { return nil, wrap_error("Error retrieving assetID: ", err) }
+
+		if caller_affiliation != MINER && v.Owner != caller {
+															return nil, permission_error("Permission denied. scrap_jewellery, " + assetID + " is not owned by the caller")
+		}
+
+		if !v.Scrapped {
+			if err = check_updatable(v); err != nil { return nil, err }
+		}
+
+		components = append(components, v)
+	}
+
+	for _, v := range components {
+
+		if v.Scrapped { continue }
+
+		v.ScrapReason = "Jewellery " + jewelleryID + " scrapped"
+
+		_, err = t.scrap_asset(stub, v, caller, caller_affiliation, "")
+
+															if err != nil { fmt.Printf("SCRAP_JEWELLERY: %s", err); return nil, wrap_error("Error scrapping " + v.AssetID + ": ", err) }
+	}
+
+	item.Scrapped   = true
+	item.ScrappedBy = caller
+
+	bytes, err := json.Marshal(item)
+
+															if err != nil { return nil, errors.New("Error converting jewellery record") }
+
+	err = stub.PutState(JEWELLERY_PREFIX + jewelleryID, bytes)
+
+															if err != nil { fmt.Printf("SCRAP_JEWELLERY: Error storing jewellery: %s", err); return nil, errors.New("Error storing jewellery") }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 link_rough - Records that the polished diamond was cut from the rough diamond, on both records. Only a Cutter who
+//				  owns the polished diamond can make the link and neither diamond can already be linked.
+//=================================================================================================================================
+func (t *SimpleChaincode) link_rough(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, polishedAssetID string, roughAssetID string) ([]byte, error) {
+
+	if polishedAssetID == roughAssetID { return nil, invalid_error("Invalid link, a diamond cannot be linked to itself") }
+
+	polished, err := t.retrieve_assetID(stub, polishedAssetID)
+
+															if err != nil { return nil, wrap_error("Error retrieving polished assetID: ", err) }
+
+	rough, err := t.retrieve_assetID(stub, roughAssetID)
+
+															if err != nil { return nil, wrap_error("Error retrieving rough assetID: ", err) }
+
+	if		caller_affiliation	!= CUTTER		||
+			polished.Owner		!= caller		{
+															return nil, permission_error("Permission denied. link_rough")
+	}
+
+	for _, v := range []Asset{polished, rough} {
+		if err = check_updatable(v); err != nil { return nil, err }
+	}
+
+	if polished.RoughAssetID != "" || polished.PolishedAssetID != "" { return nil, invalid_error("Asset " + polishedAssetID + " is already linked") }
+	if rough.RoughAssetID    != "" || rough.PolishedAssetID    != "" { return nil, invalid_error("Asset " + roughAssetID + " is already linked") }
+
+	polished.RoughAssetID = roughAssetID
+	rough.PolishedAssetID = polishedAssetID
+
+	_, err = t.save_changes(stub, polished)
+
+															if err != nil { fmt.Printf("LINK_ROUGH: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	_, err = t.save_changes(stub, rough)
+
+															if err != nil { fmt.Printf("LINK_ROUGH: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 batch_assign_diamondat - Assigns Diamondats to a parcel of diamonds from a JSON object of assetID to Diamondat. Each
+//							  assignment goes through update_diamondat so the usual checks apply, and a Diamondat used
+//							  twice in the same batch is rejected for every diamond it was given to. The diamonds are
+//							  handled in assetID order so every peer produces the same results.
+//=================================================================================================================================
+func (t *SimpleChaincode) batch_assign_diamondat(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, assignments_json string) ([]byte, error) {
+
+	var assignments map[string]string
+
+	err := json.Unmarshal([]byte(assignments_json), &assignments)
+
+															if err != nil { return nil, invalid_error("Invalid assignments, expected a JSON object of assetID to Diamondat") }
+
+	config, err := t.retrieve_config(stub)
+
+															if err != nil { return nil, err }
+
+	if len(assignments) > config.MaxBatch {
+															return nil, invalid_error("Invalid batch, no more than " + strconv.Itoa(config.MaxBatch) + " assetIDs allowed")
+	}
+
+	uses := make(map[string]int)
+	var assetIDs []string
+
+	for assetID, diamondat := range assignments {
+		uses[normalize_value(diamondat)]++
+		assetIDs = append(assetIDs, assetID)
+	}
+
+	sort.Strings(assetIDs)
+
+	results := []Batch_Result{}
+
+	for _, assetID := range assetIDs {
+
+		result    := Batch_Result{AssetID: assetID}
+		diamondat := normalize_value(assignments[assetID])
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil {
+			result.Error = "Error retrieving assetID"
+		} else if uses[diamondat] > 1 {
+			result.Error = "Diamondat " + diamondat + " appears more than once in the batch"
+		} else if err = check_updatable(v); err != nil {
+			result.Error = err.Error()
+		} else if _, err = t.update_diamondat(stub, v, caller, caller_affiliation, diamondat); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+		}
+
+		results = append(results, result)
+	}
+
+	return json.Marshal(results)
+}
+
+//=================================================================================================================================
+//	 bulk_scrap - Scraps every diamond in the JSON list passed, recording the reason against each, for use in a recall.
+//				  Only the Miner can do this. Each diamond succeeds or fails on its own and the result for each is
+//				  returned, so diamonds that are already scrapped are reported without stopping the rest.
+//=================================================================================================================================
+func (t *SimpleChaincode) bulk_scrap(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, ids_json string, reason string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. bulk_scrap")
+	}
+
+	var assetIDs []string
+
+	err := json.Unmarshal([]byte(ids_json), &assetIDs)
+
+															if err != nil { return nil, invalid_error("Invalid assetID list, expected a JSON array of strings") }
+
+	config, err := t.retrieve_config(stub)
+
+															if err != nil { return nil, err }
+
+	if len(assetIDs) > config.MaxBatch {
+															return nil, invalid_error("Invalid batch, no more than " + strconv.Itoa(config.MaxBatch) + " assetIDs allowed")
+	}
+
+	results := []Batch_Result{}
+
+	for _, assetID := range assetIDs {
+
+		result := Batch_Result{AssetID: assetID}
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil {
+			result.Error = "Error retrieving assetID"
+		} else if err = check_updatable(v); err != nil {
+			result.Error = err.Error()
+		} else {
+			v.ScrapReason = reason
+
+			_, err = t.scrap_asset(stub, v, caller, caller_affiliation, "")
+
+			if err != nil { result.Error = err.Error() } else { result.Success = true }
+		}
+
+		results = append(results, result)
+	}
+
+	return json.Marshal(results)
+}
+
+//=================================================================================================================================
+//	 batch_transfer - Transfers each diamond in the JSON list passed to the recipient as transfer_type. Each diamond goes
+//					  through the usual transfer checks and succeeds or fails on its own, so a diamond the caller doesn`t
+//					  own is reported without stopping the rest.
+//=================================================================================================================================
+func (t *SimpleChaincode) batch_transfer(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, ids_json string, recipient_name string, transfer_type string) ([]byte, error) {
+
+	if _, ok := transfer_edges[transfer_type]; !ok {
+															return nil, invalid_error("Invalid transfer type " + transfer_type)
+	}
+
+	var assetIDs []string
+
+	err := json.Unmarshal([]byte(ids_json), &assetIDs)
+
+															if err != nil { return nil, invalid_error("Invalid assetID list, expected a JSON array of strings") }
+
+	config, err := t.retrieve_config(stub)
+
+															if err != nil { return nil, err }
+
+	if len(assetIDs) > config.MaxBatch {
+															return nil, invalid_error("Invalid batch, no more than " + strconv.Itoa(config.MaxBatch) + " assetIDs allowed")
+	}
+
+	seen := make(map[string]bool)
+
+	results := []Batch_Result{}
+
+	for _, assetID := range assetIDs {
+
+		result := Batch_Result{AssetID: assetID}
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil {
+			result.Error = "Error retrieving assetID"
+		} else if seen[assetID] {
+			result.Error = "AssetID appears more than once in the batch"
+		} else if v.Owner != caller {
+			result.Error = "Permission denied, asset is not owned by the caller"
+		} else if err = check_transferable(v); err != nil {
+			result.Error = err.Error()
+		} else if _, err = t.dispatch_transfer(stub, v, caller, caller_affiliation, transfer_type, recipient_name); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+		}
+
+		seen[assetID] = true
+
+		results = append(results, result)
+	}
+
+	return json.Marshal(results)
+}
+
+//=================================================================================================================================
+//	 set_config - Overrides configuration values. Only the fields present in the JSON passed are changed. Only the Miner
+//				  can change the configuration.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_config(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, config_json string) ([]byte, error) {
+
+	if caller_affiliation != MINER {
+															return nil, permission_error("Permission denied. set_config")
+	}
+
+	config, err := t.retrieve_config(stub)
+
+															if err != nil { return nil, err }
+
+	err = json.Unmarshal([]byte(config_json), &config)
+
+															if err != nil { return nil, invalid_error("Invalid config JSON") }
+
+	_, err = regexp.Compile(config.AssetIDPattern)
+
+															if err != nil || config.AssetIDPattern == "" { return nil, invalid_error("Invalid assetID pattern") }
+
+	if config.MaxBatch < 1 {
+															return nil, invalid_error("Invalid maxBatch, must be at least 1")
+	}
+
+	if config.MaxAssets < 1 {
+															return nil, invalid_error("Invalid maxAssets, must be at least 1")
+	}
+
+	if config.CreateLimit < 1 || config.CreateWindow < 1 {
+															return nil, invalid_error("Invalid createLimit or createWindow, both must be at least 1")
+	}
+
+	bytes, err := json.Marshal(config)
+
+															if err != nil { return nil, errors.New("Error converting config record") }
+
+	err = stub.PutState("config", bytes)
+
+															if err != nil { fmt.Printf("SET_CONFIG: Error storing config: %s", err); return nil, errors.New("Error storing config") }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 set_grade_vocabulary - Replaces the allowed grades for a grading field. Only the Miner can change these.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_grade_vocabulary(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, field string, values_json string) ([]byte, error) {
+
+	if caller_affiliation != MINER {
+															return nil, permission_error("Permission denied. set_grade_vocabulary")
+	}
+
+	if _, ok := default_grade_vocabularies[field]; !ok {
+															return nil, invalid_error("Unknown grading field " + field)
+	}
+
+	var values []string
+
+	err := json.Unmarshal([]byte(values_json), &values)
+
+															if err != nil { return nil, invalid_error("Invalid grade list, expected a JSON array of strings") }
+
+	if len(values) == 0 {
+															return nil, invalid_error("Grade list for " + field + " cannot be empty")
+	}
+
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" { return nil, invalid_error("Grade list for " + field + " cannot contain empty grades") }
+	}
+
+	bytes, err := json.Marshal(values)
+
+															if err != nil { return nil, errors.New("Error converting grade list") }
+
+	err = stub.PutState(GRADE_VOCABULARY_PREFIX + field, bytes)
+
+															if err != nil { fmt.Printf("SET_GRADE_VOCABULARY: Error storing vocabulary: %s", err); return nil, errors.New("Error storing vocabulary") }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 update_gia_cert - Records the GIA certificate number of the diamond. A number can only ever belong to one diamond so
+//					   the gia index is checked and updated along with the diamond.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_gia_cert(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				!= caller		{
+															return nil, permission_error("Permission denied")
+	}
+
+	err := t.assign_gia_cert(stub, &v, new_value)
+
+															if err != nil { return nil, err }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_GIA_CERT: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 assign_gia_cert - Sets the GIA certificate number on the diamond, moving its entry in the gia index. Only changes the
+//					   in memory copy of the diamond, the caller is responsible for saving.
+//=================================================================================================================================
+func (t *SimpleChaincode) assign_gia_cert(stub  shim.ChaincodeStubInterface, v *Asset, new_value string) error {
+
+	new_value = normalize_value(new_value)
+
+	if is_undefined(new_value) {
+															return invalid_error("Invalid GIA certificate number")
+	}
+
+	if v.GIACert == new_value { return nil }				// Already assigned to this diamond, nothing to do
+
+	claimed, err := stub.GetState(GIA_INDEX_PREFIX + new_value)
+
+															if err != nil { fmt.Printf("ASSIGN_GIA_CERT: Error retrieving gia index: %s", err); return errors.New("Error retrieving gia index") }
+
+	if claimed != nil && string(claimed) != v.AssetID {
+															return invalid_error("GIA certificate " + new_value + " already exists on asset " + string(claimed))
+	}
+
+	if !is_undefined(v.GIACert) {
+
+		err = stub.DelState(GIA_INDEX_PREFIX + v.GIACert)
+
+															if err != nil { fmt.Printf("ASSIGN_GIA_CERT: Error removing old gia index: %s", err); return errors.New("Error updating gia index") }
+	}
+
+	err = stub.PutState(GIA_INDEX_PREFIX + new_value, []byte(v.AssetID))
+
+															if err != nil { fmt.Printf("ASSIGN_GIA_CERT: Error storing gia index: %s", err); return errors.New("Error updating gia index") }
+
+	if v.GIACertAt == "" {
+
+		v.GIACertAt, err = t.get_tx_time(stub)
+
+															if err != nil { return err }
+	}
+
+	v.GIACert = new_value
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 reissue_gia_cert - Replaces the GIA certificate number when GIA reissues a report under a new number. Only the Miner
+//						can reissue and a reason must be given, which is kept with the old and new numbers.
+//=================================================================================================================================
+func (t *SimpleChaincode) reissue_gia_cert(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string, reason string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. reissue_gia_cert")
+	}
+
+	if strings.TrimSpace(reason) == "" {
+															return nil, invalid_error("Invalid reissue, a reason must be given")
+	}
+
+	if is_undefined(v.GIACert) {
+															return nil, invalid_error("Invalid reissue, asset " + v.AssetID + " has no GIA certificate to replace")
+	}
+
+	old_value := v.GIACert
+
+	err := t.assign_gia_cert(stub, &v, new_value)
+
+															if err != nil { return nil, err }
+
+	if v.GIACert == old_value {
+															return nil, invalid_error("Invalid reissue, the new GIA certificate number is the same as the old one")
+	}
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	v.GIAReissues = append(v.GIAReissues, GIA_Reissue_Record{Old: old_value, New: v.GIACert, Reason: reason, ReissuedBy: caller, Timestamp: timestamp})
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("REISSUE_GIA_CERT: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 set_metadata - Sets a free form key/value pair on the diamond. Only the current owner or the Miner can write metadata.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_metadata(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, key string, value string) ([]byte, error) {
+
+	if		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. set_metadata")
+	}
+
+	if strings.TrimSpace(key) == "" {
+															return nil, invalid_error("Invalid metadata key, cannot be empty")
+	}
+
+	if v.Metadata == nil { v.Metadata = make(map[string]string) }
+
+	v.Metadata[key] = value
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SET_METADATA: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 update_origin - Records the mine the diamond came from. Origin is only known by the Miner so it can only be set
+//					 while the diamond is still being mined.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_origin(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller			&&
+			v.Status			== STATE_MINING		{
+
+					v.Origin = new_value
+
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_ORIGIN: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 set_kp_cert - Records the Kimberley Process certificate the rough diamond was imported under. Only the Miner can set
+//				   it, at any stage, so a stone that left the mine without one can still be certified before it reaches
+//				   a dealership. Each participant country numbers its certificates its own way, so any non-blank number
+//				   is recorded as given.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_kp_cert(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, number string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER			{
+															return nil, permission_error("Permission denied. set_kp_cert")
+	}
+
+	number = strings.TrimSpace(number)
+
+	if		number				== ""				{
+															return nil, invalid_error("Invalid Kimberley Process certificate, a certificate number is required")
+	}
+
+	v.KPCertNumber = number
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SET_KP_CERT: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 update_location - Records where the diamond currently is. Only the owner can set the location.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_location(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				== caller		{
+
+					v.Location = new_value
+
+	} else {
+															return nil, permission_error("Permission denied")
+	}
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_LOCATION: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 update_carat - Records the carat weight of the diamond. The weight is set by the Miner while the diamond is being
+//					mined, after that it can only go down through record_repolish.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_carat(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		v.Owner				!= caller			||
+			v.Status			!= STATE_MINING		{
+															return nil, permission_error("Permission denied")
+	}
+
+	carat, err := strconv.ParseFloat(new_value, 64)
+
+															if err != nil || carat <= 0 { return nil, invalid_error("Invalid carat " + new_value + ", must be a positive number") }
+
+	v.Carat = carat
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_CARAT: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 record_repolish - Records that the diamond lost weight when it was re-polished. Only a Cutter who owns the diamond
+//					   can record this, a reason must be given and the new weight must be lower than the current one.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_repolish(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string, reason string) ([]byte, error) {
+
+	if		v.Owner				!= caller		||
+			caller_affiliation	!= CUTTER		{
+															return nil, permission_error("Permission denied. record_repolish")
+	}
+
+	if strings.TrimSpace(reason) == "" {
+															return nil, invalid_error("Invalid repolish, a reason must be given")
+	}
+
+	carat, err := strconv.ParseFloat(new_value, 64)
+
+															if err != nil || carat <= 0 { return nil, invalid_error("Invalid carat " + new_value + ", must be a positive number") }
+
+	if carat >= v.Carat {
+															return nil, invalid_error("Invalid repolish, the new carat weight must be lower than " + strconv.FormatFloat(v.Carat, 'f', -1, 64))
+	}
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	v.RepolishHistory = append(v.RepolishHistory, Repolish_Record{OldCarat: v.Carat, NewCarat: carat, Reason: reason, RecordedBy: caller, Timestamp: timestamp})
+	v.Carat           = carat
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RECORD_REPOLISH: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 update_payment_status - Records how much of the sale price has been paid. The seller, who still owns the diamond
+//							 until the sale completes, can record unpaid or partial. Only the Miner can confirm the
+//							 diamond as paid, so the seller can`t clear the paid gate on a transfer edge by itself.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_payment_status(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	if		new_value != PAYMENT_UNPAID		&&
+			new_value != PAYMENT_PARTIAL	&&
+			new_value != PAYMENT_PAID		{
+															return nil, invalid_error("Invalid payment status " + new_value + ", expected unpaid, partial or paid")
+	}
+
+	if		caller_affiliation	!= MINER		&&
+			(v.Owner			!= caller		||
+			 new_value			== PAYMENT_PAID) {
+															return nil, permission_error("Permission denied. update_payment_status, only the Miner can confirm payment")
+	}
+
+	v.PaymentStatus = new_value
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_PAYMENT_STATUS: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 add_label - Tags the diamond with a free-form label such as showroom or vault. Only the owner can label a diamond.
+//=================================================================================================================================
+func (t *SimpleChaincode) add_label(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, label string) ([]byte, error) {
+
+	if		v.Owner				!= caller		{
+															return nil, permission_error("Permission denied. add_label")
+	}
+
+	label = strings.TrimSpace(label)
+
+	if label == "" { return nil, invalid_error("Invalid label, cannot be empty") }
+
+	for _, existing := range v.Labels {
+		if existing == label { return nil, invalid_error("Label " + label + " already exists on asset " + v.AssetID) }
+	}
+
+	v.Labels = append(v.Labels, label)
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("ADD_LABEL: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 remove_label - Removes a label from the diamond. Only the owner can do this.
+//=================================================================================================================================
+func (t *SimpleChaincode) remove_label(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, label string) ([]byte, error) {
+
+	if		v.Owner				!= caller		{
+															return nil, permission_error("Permission denied. remove_label")
+	}
+
+	label = strings.TrimSpace(label)
+
+	labels := []string{}
+
+	for _, existing := range v.Labels {
+		if existing != label { labels = append(labels, existing) }
+	}
+
+	if len(labels) == len(v.Labels) { return nil, not_found_error("Label " + label + " not found on asset " + v.AssetID) }
+
+	v.Labels = labels
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("REMOVE_LABEL: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 add_image_hash - Attaches the SHA-256 hash of a photo of the diamond. Only the owner can add photos and the number
+//					  kept is capped at MAX_IMAGE_HASHES.
+//=================================================================================================================================
+func (t *SimpleChaincode) add_image_hash(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, hash string) ([]byte, error) {
+
+	if		v.Owner				!= caller		{
+															return nil, permission_error("Permission denied. add_image_hash")
+	}
+
+	err := validate_sha256(hash)
+
+															if err != nil { return nil, err }
+
+	hash = strings.ToLower(hash)
+
+	for _, existing := range v.ImageHashes {
+		if existing == hash { return nil, invalid_error("Image hash already exists on asset " + v.AssetID) }
+	}
+
+	if len(v.ImageHashes) >= MAX_IMAGE_HASHES {
+															return nil, invalid_error("Invalid image hash, asset already has the maximum of " + strconv.Itoa(MAX_IMAGE_HASHES) + " images")
+	}
+
+	v.ImageHashes = append(v.ImageHashes, hash)
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("ADD_IMAGE_HASH: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 set_custodian - Records who physically holds the diamond, which for high value stones can differ from the owner.
+//					 Only the owner can set the custodian. Kept for existing clients, the change is recorded in the
+//					 custody history in the same way as transfer_custody.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_custodian(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, custodian string) ([]byte, error) {
+
+	return t.transfer_custody(stub, v, caller, caller_affiliation, custodian)
+
+}
+
+//=================================================================================================================================
+//	 transfer_custody - Hands physical custody of the diamond to someone else, for example a shipping company, and adds
+//						the change to the custody history. The owner and status are left as they are. Only the owner
+//						can move custody.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer_custody(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, custodian string) ([]byte, error) {
+
+	if		v.Owner				!= caller		{
+															return nil, permission_error("Permission denied. transfer_custody")
+	}
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	v.CustodyHistory = append(v.CustodyHistory, Custody_Record{From: v.Custodian, Custodian: custodian, ChangedBy: caller, Timestamp: timestamp})
+	v.Custodian      = custodian
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("TRANSFER_CUSTODY: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 set_archived - Archives or unarchives the diamond. Only the owner or the Miner can archive.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_archived(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, value string) ([]byte, error) {
+
+	if		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. set_archived")
+	}
+
+	archived, err := strconv.ParseBool(value)
+
+															if err != nil { return nil, invalid_error("Invalid archived value " + value) }
+
+	v.Archived = archived
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SET_ARCHIVED: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 set_held - Places or lifts a hold on the diamond, for example during an investigation. Only the Miner can do this.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_held(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, value string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. set_held")
+	}
+
+	held, err := strconv.ParseBool(value)
+
+															if err != nil { return nil, invalid_error("Invalid held value " + value) }
+
+	v.Held = held
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SET_HELD: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 set_disputed - Marks the diamond as disputed, for example when its ownership is contested, or clears the dispute.
+//					Only the Miner can do this.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_disputed(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, value string) ([]byte, error) {
+
+	if		caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. set_disputed")
+	}
+
+	disputed, err := strconv.ParseBool(value)
+
+															if err != nil { return nil, invalid_error("Invalid disputed value " + value) }
+
+	v.Disputed = disputed
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SET_DISPUTED: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 record_price - Adds a sale price or valuation to the diamond`s price history. Only the owner or the Miner can record
+//					a price.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_price(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, price_arg string) ([]byte, error) {
+
+	if		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+															return nil, permission_error("Permission denied. record_price")
+	}
+
+	price, err := strconv.ParseFloat(price_arg, 64)
+
+															if err != nil || price < 0 { return nil, invalid_error("Invalid price " + price_arg) }
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	v.PriceHistory = append(v.PriceHistory, Price_Record{Price: price, RecordedBy: caller, Timestamp: timestamp})
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RECORD_PRICE: Error saving changes: %s", err); return nil, wrap_error("Error saving changes: ", err) }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 Read Functions
+//=================================================================================================================================
+//	 get_asset_details - The owner and the Miner can see a diamond. Once it is scrapped the Scrap Merchant who scrapped
+//						 it can still see it too.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_asset_details(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+	
+	if !can_view_asset(v, caller, caller_affiliation) {
+																return nil, permission_error("Permission Denied.get_asset_details")	
+	}
+
+	bytes, err := json.Marshal(v)
+	
+																if err != nil { return nil, errors.New("GET_ASSET_DETAILS: Invalid asset object") }
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 can_view_asset - Returns true if the caller may see the diamond, that is the owner, the Miner or the scrap merchant
+//					  who scrapped it. Queries looping over diamonds use this to skip the ones the caller can`t see, so
+//					  that any other error still stops the query.
+//=================================================================================================================================
+func can_view_asset(v Asset, caller string, caller_affiliation string) bool {
+
+	return 	v.Owner				== caller		||
+			caller_affiliation	== MINER		||
+			(v.Scrapped && caller_affiliation == SCRAP_MERCHANT && scrapped_by(v) == caller)
+}
+
+//=================================================================================================================================
+//	 get__assets - Returns every diamond the caller can see. Archived and held diamonds are only included when the
+//				   matching flag is set. The Miner sees every diamond so reads the full list, anyone else can only see
+//				   the diamonds they own so reads their entries in the owner index.
+//=================================================================================================================================
+
+func (t *SimpleChaincode) get_assets(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, include_archived bool, include_held bool) ([]byte, error) {
+
+	var assetIDs []string
+
+	if caller_affiliation == MINER {
+
+		holder, err := t.retrieve_asset_ids(stub)
+
+																			if err != nil { return nil, err }
+
+		assetIDs = holder.AssetIDs
+
+	} else {
+
+		owned, err := t.retrieve_owned_ids(stub, caller)
+
+																			if err != nil { return nil, err }
+
+		assetIDs = owned
+	}
+	
+	result := "["
+	
+	var temp []byte
+	var v Asset
+	var err error
+	
+	for _, assetID := range assetIDs {
+		
+		v, err = t.retrieve_assetID(stub, assetID)
+		
+		if err != nil {return nil, errors.New("Failed to retrieve AssetID")}
+		
+		if (v.Archived && !include_archived) || (v.Held && !include_held) { continue }		// Archived and held diamonds are left out unless asked for
+		
+		if !can_view_asset(v, caller, caller_affiliation) { continue }						// Diamonds the caller can`t see are skipped, any other error stops the query
+		
+		temp, err = t.get_asset_details(stub, v, caller, caller_affiliation)
+		
+		if err != nil { return nil, err }
+		
+		result += string(temp) + ","	
+	}
+	
+	if len(result) == 1 {
+		result = "[]"
+	} else {
+		result = result[:len(result)-1] + "]"
+	}
+	
+	return []byte(result), nil
+}
+
+//=================================================================================================================================
+//	 retrieve_visible_assets - Returns every diamond the caller is allowed to see for which the filter passed returns true.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_visible_assets(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, filter func(Asset) bool) ([]Asset, error) {
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	assets := []Asset{}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		if !filter(v) { continue }
+
+		if can_view_asset(v, caller, caller_affiliation) {
+			assets = append(assets, v)
+		}
+	}
+
+	return assets, nil
+}
+
+//=================================================================================================================================
+//	 scrapped_by - Returns who scrapped the diamond, taken from the status history. Returns nothing if it hasn`t been
+//				   scrapped or was scrapped before the status history was kept.
+//=================================================================================================================================
+func scrapped_by(v Asset) string {
+
+	for i := len(v.StatusHistory) - 1; i >= 0; i-- {
+		if v.StatusHistory[i].To == status_labels[STATE_BEING_SCRAPPED] { return v.StatusHistory[i].ChangedBy }
+	}
+
+	return ""
+}
+
+//=================================================================================================================================
+//	 creator_of - Returns who created the diamond. Records written before Creator was stored fall back to the first entry
+//				  in the ownership history.
+//=================================================================================================================================
+func creator_of(v Asset) string {
+
+	if v.Creator != "" { return v.Creator }
+
+	if len(v.OwnershipHistory) == 0 || v.OwnershipHistory[0].From != "" { return "" }
+
+	return v.OwnershipHistory[0].Owner
+}
+
+//=================================================================================================================================
+//	 created_at - Returns when the diamond was created, falling back to the time of the creation entry in the ownership
+//				  history for diamonds created before the creation time was stored.
+//=================================================================================================================================
+func created_at(v Asset) string {
+
+	if v.CreatedAt != "" { return v.CreatedAt }
+
+	if len(v.OwnershipHistory) == 0 || v.OwnershipHistory[0].From != "" { return "" }
+
+	return v.OwnershipHistory[0].Timestamp
+}
+
+//=================================================================================================================================
+//	 get_creation_counts_by_day - Returns how many diamonds were created on each day from start to end inclusive, both
+//								  given as dates. Days without any creations are left out. Only the Miner can run this.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_creation_counts_by_day(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, start_arg string, end_arg string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_creation_counts_by_day") }
+
+	start, err := time.Parse("2006-01-02", start_arg)
+
+																				if err != nil { return nil, invalid_error("Invalid start " + start_arg + ", expected a date such as 2006-01-02") }
+
+	end, err := time.Parse("2006-01-02", end_arg)
+
+																				if err != nil { return nil, invalid_error("Invalid end " + end_arg + ", expected a date such as 2006-01-02") }
+
+	if end.Before(start) { return nil, invalid_error("Invalid date range, end is before start") }
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	counts := make(map[string]int)
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		created, err := time.Parse(time.RFC3339, v.CreatedAt)
+
+		if err != nil { continue }											// Creation time unknown
+
+		day := created.UTC().Format("2006-01-02")
+
+		if day < start_arg || day > end_arg { continue }
+
+		counts[day]++
+	}
+
+	return json.Marshal(counts)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_by_creator_and_status - Returns the diamonds the creator passed created that are now in the status
+//										  passed, wherever they are in the chain. Only the creator or the Miner can see
+//										  these.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_by_creator_and_status(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, creator string, status_arg string) ([]byte, error) {
+
+	if 		creator				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_diamonds_by_creator_and_status")
+	}
+
+	status, err := strconv.Atoi(status_arg)
+
+																				if err != nil { return nil, invalid_error("Invalid status " + status_arg) }
+
+	if _, ok := status_labels[status]; !ok { return nil, invalid_error("Invalid status " + status_arg) }
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	assets := []Asset{}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		if creator_of(v) == creator && v.Status == status { assets = append(assets, v) }
+	}
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_by_location - Returns the diamonds the caller can see whose location matches the one passed exactly.
+//								Diamonds without a location never match.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_by_location(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, location string) ([]byte, error) {
+
+	location = normalize_value(location)
+
+	if is_undefined(location) { return nil, invalid_error("Invalid location, cannot be empty") }
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+		return v.Location == location
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_unidentified_diamonds - Returns the worklist of diamonds still waiting for a Diamondat. Owners see their own
+//								 diamonds and the Miner sees every one. Scrapped diamonds are left out.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_unidentified_diamonds(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+		return !v.Scrapped && is_undefined(v.Diamondat)
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_in_jewel_stage - Returns the caller`s diamonds that are in the jewel making stage, a Jewellery Maker`s
+//								   work in progress.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_in_jewel_stage(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+		return v.Owner == caller && v.Status == STATE_JEWEL_MAKING
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_by_label - Returns the caller`s own diamonds tagged with the label passed. Labels are the owner`s way of
+//							 organising their stock so only their own diamonds are searched.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_by_label(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, label string) ([]byte, error) {
+
+	label = strings.TrimSpace(label)
+
+	if label == "" { return nil, invalid_error("Invalid label, cannot be empty") }
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+
+		if v.Owner != caller { return false }
+
+		for _, existing := range v.Labels {
+			if existing == label { return true }
+		}
+
+		return false
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_transferable_to - Returns the caller`s diamonds that could be moved to the role passed right now, that is those
+//						   meeting every check move_along_edge makes on a transfer edge from the caller`s role to it.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_transferable_to(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, role string) ([]byte, error) {
+
+	edges := []Transfer_Edge{}
+
+	for _, edge := range transfer_edges {
+		if edge.From == caller_affiliation && edge.To == role { edges = append(edges, edge) }
+	}
+
+	if len(edges) == 0 { return nil, invalid_error("Invalid role, no transfer from " + caller_affiliation + " to " + role) }
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+
+		if v.Scrapped || v.Owner != caller { return false }
+
+		for _, edge := range edges {
+			if v.Status != edge.RequiredStatus { continue }
+			if edge.RequiresPaid && v.PaymentStatus != PAYMENT_PAID { continue }
+			if edge.RequiresKPCert && !is_undefined(v.Origin) && v.KPCertNumber == "" { continue }
+
+			ready := true
+
+			for _, field := range edge.RequiredFields {
+				if is_undefined(field_value(v, field)) { ready = false }
+			}
+
+			if ready { return true }
+		}
+
+		return false
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_paged - Returns up to page_size of the diamonds the caller can see, in index order, starting after the
+//						  bookmark. The bookmark must be empty for the first page or an assetID in the index, otherwise
+//						  the page couldn`t be located reliably and an error is returned.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_paged(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, bookmark string, page_size_arg string) ([]byte, error) {
+
+	config, err := t.retrieve_config(stub)
+
+																				if err != nil { return nil, err }
+
+	page_size, err := strconv.Atoi(page_size_arg)
+
+																				if err != nil || page_size < 1 || page_size > config.MaxBatch { return nil, invalid_error("Invalid page size, must be between 1 and " + strconv.Itoa(config.MaxBatch)) }
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	start := 0
+
+	if bookmark != "" {
+
+		start = -1
+
+		for i, assetID := range assetIDs.AssetIDs {
+			if assetID == bookmark { start = i + 1; break }
+		}
+
+		if start == -1 { return nil, invalid_error("Invalid bookmark " + bookmark + ", not a known assetID") }
+	}
+
+	page := Diamond_Page{Diamonds: []Asset{}}
+
+	for i := start; i < len(assetIDs.AssetIDs); i++ {
+
+		if len(page.Diamonds) == page_size { page.Bookmark = assetIDs.AssetIDs[i-1]; break }
+
+		v, err := t.retrieve_assetID(stub, assetIDs.AssetIDs[i])
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		if can_view_asset(v, caller, caller_affiliation) {
+			page.Diamonds = append(page.Diamonds, v)
+		}
+	}
+
+	return json.Marshal(page)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_by_owner_statuses - Returns the diamonds of the owner passed that are in any of the statuses listed.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_by_owner_statuses(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, owner string, statuses_json string) ([]byte, error) {
+
+	var statuses []int
+
+	err := json.Unmarshal([]byte(statuses_json), &statuses)
+
+																				if err != nil { return nil, invalid_error("Invalid status list, expected a JSON array of integers") }
+
+	wanted := make(map[int]bool)
+
+	for _, status := range statuses {
+
+		if _, ok := status_labels[status]; !ok { return nil, invalid_error("Invalid status " + strconv.Itoa(status)) }
+
+		wanted[status] = true
+	}
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+		return v.Owner == owner && wanted[v.Status]
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_by_owners - Returns the diamonds held by any of the owners listed. The Miner can list any owners, anyone
+//							  else can only list the owners they control, which for now is only themselves.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_by_owners(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, owners_json string) ([]byte, error) {
+
+	var owners []string
+
+	err := json.Unmarshal([]byte(owners_json), &owners)
+
+																				if err != nil || len(owners) == 0 { return nil, invalid_error("Invalid owner list, expected a JSON array of owner names") }
+
+	wanted := make(map[string]bool)
+
+	for _, owner := range owners {
+
+		if caller_affiliation != MINER && owner != caller { return nil, permission_error("Permission Denied. get_diamonds_by_owners, " + owner + " is not controlled by the caller") }
+
+		wanted[owner] = true
+	}
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+		return wanted[v.Owner]
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_diamonds_grouped - Returns the diamonds the caller can see as a JSON object keyed by status label. Every status
+//							appears in the result, with an empty list if there are no diamonds in it.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_diamonds_grouped(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	groups := make(map[string][]Asset)
+
+	for _, label := range status_labels {
+		groups[label] = []Asset{}
+	}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		if can_view_asset(v, caller, caller_affiliation) {
+			groups[status_labels[v.Status]] = append(groups[status_labels[v.Status]], v)
+		}
+	}
+
+	return json.Marshal(groups)
+}
+
+//=================================================================================================================================
+//	 provenance_problems - Lists what is missing from the provenance of a diamond. An empty list means the provenance is
+//						   complete. The ownership history must run unbroken from creation to the current owner.
+//=================================================================================================================================
+func provenance_problems(v Asset) []string {
+
+	problems := []string{}
+
+	if is_undefined(v.Origin)  { problems = append(problems, "missing origin") }
+	if is_undefined(v.GIACert) { problems = append(problems, "missing GIA certificate") }
+
+	if len(v.OwnershipHistory) == 0 {
+		return append(problems, "no ownership history")
+	}
+
+	if v.OwnershipHistory[0].From != "" { problems = append(problems, "ownership history does not start at creation") }
+
+	for i := 1; i < len(v.OwnershipHistory); i++ {
+		if v.OwnershipHistory[i].From != v.OwnershipHistory[i-1].Owner {
+			problems = append(problems, "ownership history gap before entry " + strconv.Itoa(i))
+		}
+	}
+
+	if v.OwnershipHistory[len(v.OwnershipHistory)-1].Owner != v.Owner { problems = append(problems, "ownership history does not end at the current owner") }
+
+	return problems
+}
+
+//=================================================================================================================================
+//	 ownership_anomalies - Looks for signs of corruption or fraud in the ownership history: an owner appearing more than
+//						   once, which means the diamond looped back to them, and consecutive owners whose roles
+//						   aren`t joined by any transfer edge.
+//=================================================================================================================================
+func ownership_anomalies(v Asset) []string {
+
+	anomalies := []string{}
+	seen      := make(map[string]int)
+
+	for i, record := range v.OwnershipHistory {
+
+		if first, ok := seen[record.Owner]; ok {
+			anomalies = append(anomalies, "owner " + record.Owner + " at entry " + strconv.Itoa(i) + " already owned the diamond at entry " + strconv.Itoa(first))
+		} else {
+			seen[record.Owner] = i
+		}
+
+		if i == 0 || record.AuthorizedBy != "" { continue }				// Admin transfers are allowed to skip the transfer edges
+
+		previous := v.OwnershipHistory[i-1].Affiliation
+		allowed  := false
+
+		for _, edge := range transfer_edges {
+			if edge.From == previous && edge.To == record.Affiliation { allowed = true; break }
+		}
+
+		if !allowed {
+			anomalies = append(anomalies, "no transfer from " + previous + " to " + record.Affiliation + " at entry " + strconv.Itoa(i))
+		}
+	}
+
+	return anomalies
+}
+
+//=================================================================================================================================
+//	 detect_ownership_anomalies - Reports the ownership anomalies found in the diamond`s history. Only the Miner can run
+//								  this check.
+//=================================================================================================================================
+func (t *SimpleChaincode) detect_ownership_anomalies(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if 		caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. detect_ownership_anomalies")
+	}
+
+	return json.Marshal(Provenance_Report{AssetID: v.AssetID, Problems: ownership_anomalies(v)})
+}
+
+//=================================================================================================================================
+//	 provenance_score - Scores the diamond on five equally weighted factors: a recorded origin, a GIA certificate, every
+//						grade set, at least one photo and an unbroken ownership history. Only whether each factor is
+//						met is shown, not the details behind it, so anyone can see the score.
+//=================================================================================================================================
+func provenance_score(v Asset) Provenance_Score {
+
+	graded := true
+
+	for field := range default_grade_vocabularies {
+		if is_undefined(grade_value(v, field)) { graded = false }
+	}
+
+	chain_intact := len(v.OwnershipHistory) > 0 && v.OwnershipHistory[0].From == "" && v.OwnershipHistory[len(v.OwnershipHistory)-1].Owner == v.Owner
+
+	for i := 1; i < len(v.OwnershipHistory); i++ {
+		if v.OwnershipHistory[i].From != v.OwnershipHistory[i-1].Owner { chain_intact = false }
+	}
+
+	checks := []struct {
+		name string
+		met  bool
+	}{
+		{"origin",            !is_undefined(v.Origin)},
+		{"gia_certificate",   !is_undefined(v.GIACert)},
+		{"complete_grading",  graded},
+		{"image_hashes",      len(v.ImageHashes) > 0},
+		{"ownership_history", chain_intact},
+	}
+
+	score := Provenance_Score{AssetID: v.AssetID, Factors: []Score_Factor{}}
+
+	for _, check := range checks {
+
+		factor := Score_Factor{Name: check.name, Met: check.met}
+
+		if check.met { factor.Points = 100 / len(checks) }
+
+		score.Score  += factor.Points
+		score.Factors = append(score.Factors, factor)
+	}
+
+	return score
+}
+
+//=================================================================================================================================
+//	 get_incomplete_provenance - Returns a report for every diamond with a problem in its provenance. Only the Miner can
+//								 screen the whole ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_incomplete_provenance(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_incomplete_provenance") }
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	reports := []Provenance_Report{}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		problems := provenance_problems(v)
+
+		if len(problems) > 0 {
+			reports = append(reports, Provenance_Report{AssetID: v.AssetID, Problems: problems})
+		}
+	}
+
+	return json.Marshal(reports)
+}
+
+//=================================================================================================================================
+//	 last_activity - Returns when the diamond was last written, falling back to its last change of ownership for records
+//					 saved before LastUpdated was kept.
+//=================================================================================================================================
+func last_activity(v Asset) string {
+
+	if v.LastUpdated != "" { return v.LastUpdated }
+
+	if len(v.OwnershipHistory) > 0 { return v.OwnershipHistory[len(v.OwnershipHistory)-1].Timestamp }
+
+	return ""
+}
+
+//=================================================================================================================================
+//	 get_stale_diamonds - Returns the diamonds that haven`t been updated in the number of days passed, measured back from
+//						  the transaction time. Only the Miner can run this.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_stale_diamonds(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, days_arg string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_stale_diamonds") }
+
+	days, err := strconv.Atoi(days_arg)
+
+																				if err != nil || days < 1 { return nil, invalid_error("Invalid number of days " + days_arg) }
+
+	now, err := t.get_tx_time(stub)
+
+																				if err != nil { return nil, err }
+
+	current, _ := time.Parse(time.RFC3339, now)
+
+	cutoff := current.AddDate(0, 0, -days)
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+
+		last, err := time.Parse(time.RFC3339, last_activity(v))
+
+		return err == nil && last.Before(cutoff)
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_orphaned_ownership - Returns the diamonds whose current owner has been revoked. Only the Miner can run this.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_orphaned_ownership(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_orphaned_ownership") }
+
+	revoked, err := t.retrieve_revoked(stub)
+
+																				if err != nil { return nil, err }
+
+	assets, err := t.retrieve_visible_assets(stub, caller, caller_affiliation, func(v Asset) bool {
+		return revoked[v.Owner]
+	})
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_most_transferred - Returns up to limit diamonds with the longest ownership histories, most transferred first.
+//							Ties are broken by assetID so every peer returns the same list. Only the Miner can see this.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_most_transferred(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, limit_arg string) ([]byte, error) {
+
+	if 		caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_most_transferred")
+	}
+
+	limit, err := strconv.Atoi(limit_arg)
+
+																				if err != nil || limit < 1 { return nil, invalid_error("Invalid limit " + limit_arg + ", must be a positive number") }
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	assets := []Asset{}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		assets = append(assets, v)
+	}
+
+	sort.Slice(assets, func(i, j int) bool {
+		if len(assets[i].OwnershipHistory) != len(assets[j].OwnershipHistory) {
+			return len(assets[i].OwnershipHistory) > len(assets[j].OwnershipHistory)
+		}
+		return assets[i].AssetID < assets[j].AssetID
+	})
+
+	if len(assets) > limit { assets = assets[:limit] }
+
+	return json.Marshal(assets)
+}
+
+//=================================================================================================================================
+//	 get_historical_holdings - Returns every period the owner passed held a diamond, worked out from the ownership history
+//							   of every diamond, including diamonds they no longer own. Only the owner themselves or the
+//							   Miner can see these.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_historical_holdings(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, owner string) ([]byte, error) {
+
+	if 		owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_historical_holdings")
+	}
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	holdings := []Holding_Period{}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		for i, record := range v.OwnershipHistory {
+
+			if record.Owner != owner { continue }
+
+			holding := Holding_Period{AssetID: v.AssetID, Since: record.Timestamp}
+
+			if i + 1 < len(v.OwnershipHistory) { holding.Until = v.OwnershipHistory[i+1].Timestamp }
+
+			holdings = append(holdings, holding)
+		}
+	}
+
+	return json.Marshal(holdings)
+}
+
+//=================================================================================================================================
+//	 get_activity_summary - Counts the creations, transfers, scraps and grading changes made between start and end, both
+//							RFC3339 times and both inclusive, from the histories kept on each diamond. Scraps made before
+//							scrappedAt was recorded have no time and aren`t counted. Only the Miner can see this.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_activity_summary(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, start_arg string, end_arg string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_activity_summary") }
+
+	start, err := time.Parse(time.RFC3339, start_arg)
+
+																				if err != nil { return nil, invalid_error("Invalid start " + start_arg + ", expected an RFC3339 time") }
+
+	end, err := time.Parse(time.RFC3339, end_arg)
+
+																				if err != nil { return nil, invalid_error("Invalid end " + end_arg + ", expected an RFC3339 time") }
+
+	if end.Before(start) { return nil, invalid_error("Invalid time window, end is before start") }
+
+	in_window := func(timestamp string) bool {
+		when, err := time.Parse(time.RFC3339, timestamp)
+		return err == nil && !when.Before(start) && !when.After(end)
+	}
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	summary := Activity_Summary{Start: start_arg, End: end_arg}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		for _, record := range v.OwnershipHistory {
+			if !in_window(record.Timestamp) { continue }
+			if record.From == "" { summary.Creations++ } else { summary.Transfers++ }
+		}
+
+		for _, change := range v.GradingHistory {
+			if in_window(change.Timestamp) { summary.GradingChanges++ }
+		}
+
+		if v.Scrapped && in_window(v.ScrappedAt) { summary.Scraps++ }
+	}
+
+	return json.Marshal(summary)
+}
+
+//=================================================================================================================================
+//	 get_post_cert_grade_changes - Returns the diamonds whose grades were changed after their GIA certificate was first
+//								   recorded, with those changes, as a sign of tampering. Diamonds certified before the
+//								   certification time was kept can`t be checked and are left out. Only the Miner can run
+//								   this.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_post_cert_grade_changes(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_post_cert_grade_changes") }
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	results := []Post_Cert_Changes{}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		certified, err := time.Parse(time.RFC3339, v.GIACertAt)
 
-//==============================================================================================================================
-//	 Router Functions
-//==============================================================================================================================
-//	Invoke - Called on chaincode invoke. Takes a function name passed and calls that function. Converts some
-//		  initial arguments passed to other things for use in the called function e.g. name -> ecert
-//==============================================================================================================================
-func (t *SimpleChaincode) Invoke(stub  shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	
-	caller, caller_affiliation, err := t.get_caller_data(stub)
+		if err != nil { continue }											// Certification time unknown
 
-	if err != nil { return nil, errors.New("Error retrieving caller information")}
+		changes := []Grade_Change{}
 
-	
-	if function == "create_asset" { return t.create_asset(stub, caller, caller_affiliation, args[0])
-	} else if function == "ping" {
-        return t.ping(stub)
-    }  else { 																				// If the function is not a create then there must be a Diamond so we need to retrieve the Diamond.
-		
-		argPos := 1
-		
-		if function == "scrap_asset" {																// If its a scrap assets then only two arguments are passed (no update value) all others have three arguments and the assetid is expected in the last argument
-			argPos = 0
+		for _, change := range v.GradingHistory {
+
+			when, err := time.Parse(time.RFC3339, change.Timestamp)
+
+			if err == nil && when.After(certified) { changes = append(changes, change) }
 		}
-		
-		v, err := t.retrieve_assetID(stub, args[argPos])
-		
-																							if err != nil { fmt.Printf("INVOKE: Error retrieving assetID: %s", err); return nil, errors.New("Error retrieving assetID") }
-																		
-		if strings.Contains(function, "update") == false           && 
-		   function 							!= "scrap_asset"    { 									// If the function is not an update or a scrappage it must be a transfer so we need to get the ecert of the recipient.
-			
-					
-				if 		   function == "miner_to_distributor" { return t.miner_to_distributor(stub, v, caller, caller_affiliation, args[0], "distributor")
-				} else if  function == "distributor_to_dealership"   { return t.distributor_to_dealership(stub, v, caller, caller_affiliation, args[0], "dealership")
-				} else if  function == "dealership_to_buyer" 	   { return t.dealership_to_buyer(stub, v, caller, caller_affiliation, args[0], "buyer")
-				} else if  function == "buyer_to_trader"  { return t.buyer_to_trader(stub, v, caller, caller_affiliation, args[0], "trader")
-				} else if  function == "trader_to_cutter"  { return t.trader_to_cutter(stub, v, caller, caller_affiliation, args[0], "cutter")
-				} else if  function == "cutter_to_jewellery_maker" { return t.cutter_to_jewellery_maker(stub, v, caller, caller_affiliation, args[0], "jewellery_maker")
-				} else if  function == "jewellery_maker_to_customer" { return t.jewellery_maker_to_customer(stub, v, caller, caller_affiliation, args[0], "customer")
-                                }
-			
-		} else if function == "update_colour"  	    { return t.update_colour(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_cut"          { return t.update_cut(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_clarity"   { return t.update_clarity(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_symmetry" 		{ return t.update_symmetry(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_polish" 		{ return t.update_polish(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_diamondat" 		{ return t.update_diamondat(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_date" 		{ return t.update_date(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_timestamp" 		{ return t.update_timestamp(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_jewellerytype" 		{ return t.update_jewellerytype(stub, v, caller, caller_affiliation, args[0])
-		} 
-		
-																						return nil, errors.New("Function of that name doesn`t exist.")
-			
 
+		if len(changes) > 0 {
+			results = append(results, Post_Cert_Changes{AssetID: v.AssetID, GIACert: v.GIACert, CertifiedAt: v.GIACertAt, Changes: changes})
+		}
 	}
+
+	return json.Marshal(results)
 }
+
 //=================================================================================================================================
-//	 check_unique_asset
+//	 get_active_holders - Returns each current owner of a diamond that hasn`t been scrapped, with how many such diamonds
+//						  they hold. Only the Miner can run this.
 //=================================================================================================================================
-func (t *SimpleChaincode) check_unique_asset(stub shim.ChaincodeStubInterface, asset string, caller string, caller_affiliation string) ([]byte, error) {
-	_, err := t.retrieve_assets(stub, asset)
-	if err == nil {
-		return []byte("false"), errors.New("Asset is not unique")
-	} else {
-		return []byte("true"), nil
-	}
-}
-//=================================================================================================================================	//	Query - Called on chaincode query. Takes a function name passed and calls that function. Passes the
-//  		initial arguments passed are passed on to the called function.
-//=================================================================================================================================	
-func (t *SimpleChaincode) Query(stub  shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-													
-	caller, caller_affiliation, err := t.get_caller_data(stub)
+func (t *SimpleChaincode) get_active_holders(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
 
-																							if err != nil { fmt.Printf("QUERY: Error retrieving caller details", err); return nil, errors.New("QUERY: Error retrieving caller details: "+err.Error()) }
-	logger.Debug("function: ", function)
-    logger.Debug("caller: ", caller)
-    logger.Debug("affiliation: ", caller_affiliation)
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. get_active_holders") }
 
+	assetIDs, err := t.retrieve_asset_ids(stub)
 
-	if function == "get_asset_details" { 
-	
-			if len(args) != 1 { fmt.Printf("Incorrect number of arguments passed"); return nil, errors.New("QUERY: Incorrect number of arguments passed") }
-	
-	
-			v, err := t.retrieve_assetID(stub, args[0])
-																							if err != nil { fmt.Printf("QUERY: Error retrieving asseID: %s", err); return nil, errors.New("QUERY: Error retrieving assetID "+err.Error()) }
-	
-			return t.get_asset_details(stub, v, caller, caller_affiliation)
-			
-	} else if function == "check_unique_assetID" {
-		return t.check_unique_assetID(stub, args[0], caller, caller_affiliation)
-	} else if function == "get_assets" {
-		return t.get_assets(stub, caller, caller_affiliation)
-	} else if function == "get_ecert" {
-		return t.get_ecert(stub, args[0])
-	} else if function == "ping" {
-		return t.ping(stub)
-	}
+																				if err != nil { return nil, err }
 
+	holders := make(map[string]int)
 
-	
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
 
-	return nil, errors.New("Received unknown function invocation" + function)
+		if v.Scrapped { continue }
 
+		holders[v.Owner]++
+	}
+
+	return json.Marshal(holders)
 }
 
 //=================================================================================================================================
-//	 Ping Function
-//=================================================================================================================================
-//	 Pings the peer to keep the connection alive
+//	 get_transfer_stats - Counts how many diamonds the owner passed has sent and received, worked out from the ownership
+//						  history of every diamond. Only the owner themselves or the Miner can see these.
 //=================================================================================================================================
-func (t *SimpleChaincode) ping(stub shim.ChaincodeStubInterface) ([]byte, error) {
-	return []byte("Hello, world!"), nil
+func (t *SimpleChaincode) get_transfer_stats(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, owner string) ([]byte, error) {
+
+	if 		owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_transfer_stats")
+	}
+
+	assetIDs, err := t.retrieve_asset_ids(stub)
+
+																				if err != nil { return nil, err }
+
+	stats := Transfer_Stats{Owner: owner}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		for _, record := range v.OwnershipHistory {
+			if record.From  == owner                     { stats.Sent++ }
+			if record.Owner == owner && record.From != "" { stats.Received++ }
+		}
+	}
+
+	return json.Marshal(stats)
 }
 
 //=================================================================================================================================
-//	 Create Function
-//=================================================================================================================================									
-//	 Create Diamond - Creates the initial JSON for the diamond and then saves it to the ledger.									
+//	 export_snapshot - Returns the asset index and every diamond record for disaster recovery. Only the Miner can export.
+//					   Ledgers holding more than MAX_SNAPSHOT diamonds are refused rather than returning a response too
+//					   large to handle.
 //=================================================================================================================================
-func (t *SimpleChaincode) create_asset(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, assetID string) ([]byte, error) {								
+func (t *SimpleChaincode) export_snapshot(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
 
-	var v Asset																																										
-	
-	asset_ID      := "\"assetID\":\""+assetID+"\", "							
-	colour         := "\"Colour\":\"UNDEFINED\", "
-	diamondat          := "\"Diamondat\":\"UNDEFINED\", "
-	cut            := "\"Cut\":\"UNDEFINED\", "
-	clarity        := "\"Clarity\":\"UNDEFINED\", "
-	location       := "\"Location\":\"UNDEFINED\", "
-	date           := "\"Date\":\"UNDEFINED\", "
-	Timestamp          := "\"Timestamp\":\"UNDEFINED\", "
-	polish         := "\"Polish\":\"UNDEFINED\", "
-	owner          := "\"Owner\":\""+caller+"\", "
-	symmetry       := "\"Symmetry\":\"UNDEFINED\", "
-    jewelleryType :="\"JewelleryType\":\"UNDEFINED\", " 
-	status         :="\"Status\":0"
-	
-	asset_json := "{"+asset_ID+colour+diamondat+cut+clarity+location+date+timestamp+polish+owner+symmetry+jewellerytype+status+"}" 	// Concatenates the variables to create the total JSON object
-	
-	
-	matched, err := regexp.Match("^[A-z][A-z][0-9]{7}", []byte(assetID))  				// matched = true if the assetid passed fits format of two letters followed by seven digits
-	
-												if err != nil { fmt.Printf("CREATE_ASSET: Invalid assetID: %s", err); return nil, errors.New("Invalid assetID") }
-	
-	if 				asset_id  == "" 	 || 
-					matched == false    {
-																		fmt.Printf("CREATE_ASSET: Invalid assetID provided");
-																		return nil, errors.New("Invalid assetID provided")
-	}
+	if caller_affiliation != MINER { return nil, permission_error("Permission Denied. export_snapshot") }
 
-	err = json.Unmarshal([]byte(asset_json), &v)							// Convert the JSON defined above into a diamond object for go
-	
-																		if err != nil { return nil, errors.New("Invalid JSON object") }
-	
+	assetIDs, err := t.retrieve_asset_ids(stub)
 
-	record, err := stub.GetState(v.AssetID) 								// If not an error then a record exists so cant create a new Diamond with this assets_id as it must be unique
-	
-																		if record != nil { return nil, errors.New("Asset already exists") }
-	
-	if 	caller_affiliation != MINER {							// Only the Miner can create a new unique
+																				if err != nil { return nil, err }
 
-																	return nil, errors.New(fmt.Sprintf("Permission Denied. create_asset. %v === %v", caller_affiliation, MINER))
+	if len(assetIDs.AssetIDs) > MAX_SNAPSHOT {
+																				return nil, invalid_error("Invalid snapshot, the ledger holds " + strconv.Itoa(len(assetIDs.AssetIDs)) + " diamonds which is more than the limit of " + strconv.Itoa(MAX_SNAPSHOT))
+	}
 
+	snapshot := Snapshot{AssetIDs: assetIDs.AssetIDs, Diamonds: []Asset{}}
 
-	
-	_, err  = t.save_changes(stub, v)									
-			
-																		if err != nil { fmt.Printf("CREATE_DIAMOND: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	bytes, err := stub.GetState("assetIDs")
+	if snapshot.AssetIDs == nil { snapshot.AssetIDs = []string{} }
 
-																		if err != nil {fmt.Printf("Unable to get assetIDs"); return nil, errors.New("Unable to get assetIDs") }
-																		
-	var assetIDs AssetID_Holder
-	
-	err = json.Unmarshal(bytes, &assetIDs)
-	
-																		if err != nil {	return nil, errors.New("Corrupt AssetID_Holder record") }
-															
-	assetIDs.AssetIDs = append(assetIDs.AssetIDs, assetID)
-	
-	
-	bytes, err = json.Marshal(assetIDs)
-	
-															if err != nil { fmt.Print("Error creating AssetID_Holder  record") }
+	for _, assetID := range assetIDs.AssetIDs {
 
-	err = stub.PutState("assetIDs", bytes)
+		v, err := t.retrieve_assetID(stub, assetID)
 
-															if err != nil { return nil, errors.New("Unable to put the state") }
-	
-	return nil, nil
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		snapshot.Diamonds = append(snapshot.Diamonds, v)
+	}
 
+	return json.Marshal(snapshot)
 }
 
 //=================================================================================================================================
-//	 Transfer Functions
-//=================================================================================================================================
-//	 miner_to_distributor
+//	 attestation_hash - The SHA-256 of the diamond record as stored.
 //=================================================================================================================================
-func (t *SimpleChaincode) miner_to_distributor(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-if 		        v.Timestamp 	 == "TIMESTAMP" || 
-			v.Location       == "UNDEFINED"	&&
-	     	v.Status				== STATE_MINING	&&
-			v.Owner					== caller			&&
-			caller_affiliation		== MINER		&&
-			recipient_affiliation	== DISTRIBUTOR		{		// If the roles and users are ok 
-	
-					v.Owner  = recipient_name		// then make the owner the new owner
-					v.Status = STATE_DISTRIBUTING			// and mark it in the state of manufacture
-	
-	} else {									// Otherwise if there is an error
-	
-															fmt.Printf(" MINER_TO_DISTRIBUTOR: Permission Denied");
-															return nil, errors.New("Permission Denied")
-	
-	}
-	
-	_, err := t.save_changes(stub, v)						// Write new state
+func attestation_hash(v Asset) (string, error) {
 
-															if err != nil {	fmt.Printf("MINER_TO_DISTRIBUTOR: Error saving changes: %s", err); return nil, errors.New("Error saving changes")	}
-														
-	return nil, nil									// We are Done
-	
+	bytes, err := json.Marshal(v)
+
+																				if err != nil { return "", errors.New("Error converting asset record") }
+
+	return fmt.Sprintf("%x", sha256.Sum256(bytes)), nil
 }
 
 //=================================================================================================================================
-//	 distributor_to_dealer
+//	 export_jsonld - Returns the diamond with its ownership and grading history as a JSON-LD document for provenance
+//					 tools. The chaincode holds no signing key, so the document is sealed with the diamond`s attestation
+//					 hash instead. Only the owner or the Miner can export it as it includes the ownership chain.
 //=================================================================================================================================
-func (t *SimpleChaincode) distributor_to_dealership(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-	 
-   fmt.Printf("distributor_TO_DEALERSHIP %s %s %s %s ",v.Status,v.Owner,caller_affiliation,recipient_affiliation);
-	
-	if 		v.Status				== STATE_DISTRIBUTING	&& 
-			v.Owner					== caller				&& 
-			caller_affiliation		== DISTRIBUTOR			&&
-			recipient_affiliation	== DEALERSHIP		{ 
-			
-					d.Owner = recipient_name
-					d.Status = STATE_DISTRIBUTING
-					
-	} else {
-															return nil, errors.New("Permission denied")
+func (t *SimpleChaincode) export_jsonld(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if 		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. export_jsonld")
 	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("distributor_TO_DEALERSHIP: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+
+	hash, err := attestation_hash(v)
+
+																				if err != nil { return nil, err }
+
+	document := JSONLD_Diamond{
+		Context:          map[string]string{"@vocab": JSONLD_VOCAB},
+		ID:               JSONLD_VOCAB + v.AssetID,
+		Type:             "Diamond",
+		Carat:            v.Carat,
+		Colour:           v.Colour,
+		Cut:              v.Cut,
+		Clarity:          v.Clarity,
+		Polish:           v.Polish,
+		Symmetry:         v.Symmetry,
+		Fluorescence:     v.Fluorescence,
+		Origin:           v.Origin,
+		GIACert:          v.GIACert,
+		Diamondat:        v.Diamondat,
+		Status:           status_labels[v.Status],
+		Owner:            v.Owner,
+		OwnershipHistory: v.OwnershipHistory,
+		GradingHistory:   v.GradingHistory,
+		Proof:            JSONLD_Proof{Type: "Sha256Digest", Digest: hash, Created: v.LastUpdated},
+	}
+
+	return json.Marshal(document)
 }
 
 //=================================================================================================================================
-//	 dealership_to_buyer
+//	 export_attestation - Returns an attestation of the diamond as it stands. Anyone who can see the diamond can export it.
 //=================================================================================================================================
-func (t *SimpleChaincode) dealership_to_buyer(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-	if 		d.Status				== STATE_BUYING	&&
-			d.Owner					== caller					&&
-			caller_affiliation		== DEALERSHIP			&& 
-			recipient_affiliation	== BUYER			{
-			
-					d.Owner = recipient_name
-					
-	} else {
-		
-															return nil, errors.New("Permission denied")
-	
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("DEALERSHIP_TO_BUYER: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+func (t *SimpleChaincode) export_attestation(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if !can_view_asset(v, caller, caller_affiliation) { return nil, permission_error("Permission Denied. export_attestation") }
+
+	hash, err := attestation_hash(v)
+
+																				if err != nil { return nil, err }
+
+	return json.Marshal(Attestation{AssetID: v.AssetID, Hash: hash, Timestamp: v.LastUpdated})
 }
 
 //=================================================================================================================================
-//	 buyer_to_trader
+//	 verify_attestation - Checks the attestation passed against the diamond on the ledger. Only whether it matches is
+//						  returned, so anyone holding an attestation can check it.
 //=================================================================================================================================
-func (t *SimpleChaincode) buyer_to_trader(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-	if 		v.Status				== STATE_TRADING	&& 
-			v.Owner					== caller					&& 
-			caller_affiliation		== BUYER			&& 
-			recipient_affiliation	== TRADER		{	
-								
-		
-					v.Owner = recipient_name
-					
-	} else {
-															return nil, errors.New("Permission denied")
-	}
-	
-	_, err := t.save_changes(stub, v)
-															if err != nil { fmt.Printf("BUYER_TO_TRADER: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+func (t *SimpleChaincode) verify_attestation(stub  shim.ChaincodeStubInterface, blob string) Attestation_Result {
+
+	var attestation Attestation
+
+	err := json.Unmarshal([]byte(blob), &attestation)
+
+																				if err != nil { return Attestation_Result{Error: "Invalid attestation JSON"} }
+
+	result := Attestation_Result{AssetID: attestation.AssetID}
+
+	v, err := t.retrieve_assetID(stub, attestation.AssetID)
+
+																				if err != nil { result.Error = "Error retrieving assetID"; return result }
+
+	hash, err := attestation_hash(v)
+
+																				if err != nil { result.Error = err.Error(); return result }
+
+	result.Match = hash == attestation.Hash
+
+	return result
 }
 
 //=================================================================================================================================
-//	 trader_to_cutter
+//	 verify_attestations_batch - Checks each attestation in the JSON array passed and returns a result for each, in the
+//								 same order. The batch is capped by maxBatch.
 //=================================================================================================================================
-func (t *SimpleChaincode) trader_to_cutter(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-if 		        v.Assetid 	 == "UNDEFINED" || 					
-			
-			v.Status				== STATE_CUTTING	&&
-			v.Owner  				== caller					&& 
-			caller_affiliation		== TRADER			&& 
-			recipient_affiliation	== CUTTER					{
-		
-				v.Owner = recipient_name
-	
-	} else {
-															return nil, errors.New("Permission denied")
+func (t *SimpleChaincode) verify_attestations_batch(stub  shim.ChaincodeStubInterface, blobs_json string) ([]byte, error) {
+
+	var blobs []json.RawMessage
+
+	err := json.Unmarshal([]byte(blobs_json), &blobs)
+
+																				if err != nil { return nil, invalid_error("Invalid attestation list, expected a JSON array of attestations") }
+
+	config, err := t.retrieve_config(stub)
+
+																				if err != nil { return nil, err }
+
+	if len(blobs) > config.MaxBatch {
+																				return nil, invalid_error("Invalid batch, no more than " + strconv.Itoa(config.MaxBatch) + " attestations allowed")
 	}
-	
-	_, err := t.save_changes(stub, d)
-															if err != nil { fmt.Printf("TRADER_TO_CUTTER: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+
+	results := []Attestation_Result{}
+
+	for _, blob := range blobs {
+		results = append(results, t.verify_attestation(stub, string(blob)))
+	}
+
+	return json.Marshal(results)
 }
 
 //=================================================================================================================================
-//	 cutter_to_jewellery_maker
+//	 get_jewellery_components - Returns the piece of jewellery with its component diamonds. The Miner can see any piece,
+//								anyone else must own at least one of its diamonds.
 //=================================================================================================================================
-func (t *SimpleChaincode) cutter_to_jewellery_maker(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-if 		        v.Cut 	    == "UNDEFINED" || 					
-			v.Symmetry  == "UNDEFINED" || 
-                        v.Polish    == "UNDEFINED" || 
-                        v.AssetID == "UNDEFINED" || 
- v.Status				== STATE_JEWEL_MAKING	&&
-			v.Owner					== caller					&& 
-			caller_affiliation		== CUTTER			&& 
-			recipient_affiliation	== JEWELLERYMAKER		{
-			
-					v.Owner = recipient_name
-					
-	} else {
-		
-															return nil, errors.New("Permission denied")
-	
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("CUTTER_TO_JEWELLERY_MAKER: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+func (t *SimpleChaincode) get_jewellery_components(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, jewelleryID string) ([]byte, error) {
+
+	item, err := t.retrieve_jewellery(stub, jewelleryID)
+
+																				if err != nil { return nil, err }
+
+	allowed := caller_affiliation == MINER
+
+	for _, assetID := range item.Components {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		if v.Owner == caller { allowed = true }
+	}
+
+	if !allowed { return nil, permission_error("Permission Denied. get_jewellery_components") }
+
+	return json.Marshal(item)
 }
+
 //=================================================================================================================================
-//	 jewellery_maker_to_customer
+//	 get_status_history - Returns the diamond`s status changes, oldest first, with who made each one. Only the owner or
+//						  the Miner can see this.
 //=================================================================================================================================
-func (t *SimpleChaincode) jewellery_maker_to_customer (stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
-	
-if 		        v.JewelleryType	    == "UNDEFINED" || 					
-			
-				v.Status				== STATE_PURCHASING	&&
-			v.Owner					== caller					&& 
-			caller_affiliation		== JEWELLERYMAKER			&& 
-			recipient_affiliation	== CUSTOMER			{
-			
-					v.Owner = recipient_name
-					
-	} else {
-		
-															return nil, errors.New("Permission denied")
-	
+func (t *SimpleChaincode) get_status_history(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if 		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_status_history")
 	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("JEWELLERY_MAKER_TO_CUSTOMER: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+
+	return json.Marshal(v.StatusHistory)
 }
 
+//=================================================================================================================================
+//	 get_rough_link - Returns the assetID of the diamond linked to the one passed, the rough for a polished diamond or the
+//					  polished for a rough one. Returns nothing if it isn`t linked.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_rough_link(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if 		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_rough_link")
+	}
+
+	if v.RoughAssetID != "" { return []byte(v.RoughAssetID), nil }
 
+	return []byte(v.PolishedAssetID), nil
+}
 
 //=================================================================================================================================
-//	 update_cut
+//	 compare_diamonds - Returns the carat and each descriptive field on which the two diamonds passed differ. The caller
+//						must be able to see both diamonds.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_cut(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) compare_diamonds(stub  shim.ChaincodeStubInterface, a Asset, b Asset, caller string, caller_affiliation string) ([]byte, error) {
 
-	
-	if		v.Owner				== caller		{
-			
-					v.Cut = new_value
-	
-	} else {
-															return nil, errors.New("Permission denied")
+	for _, v := range []Asset{a, b} {
+
+		if !can_view_asset(v, caller, caller_affiliation) { return nil, permission_error("Permission Denied. compare_diamonds") }
 	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("UPDATE_CUT: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
-}
 
+	comparison := Diamond_Comparison{AssetA: a.AssetID, AssetB: b.AssetID, Differences: []Field_Difference{}}
+
+	if a.Carat != b.Carat {
+		comparison.Differences = append(comparison.Differences, Field_Difference{Field: "carat", A: strconv.FormatFloat(a.Carat, 'f', -1, 64), B: strconv.FormatFloat(b.Carat, 'f', -1, 64)})
+	}
+
+	for _, field := range []string{"colour", "cut", "clarity", "polish", "symmetry", "fluorescence", "origin", "jewellerytype"} {
+		if field_value(a, field) != field_value(b, field) {
+			comparison.Differences = append(comparison.Differences, Field_Difference{Field: field, A: field_value(a, field), B: field_value(b, field)})
+		}
+	}
+
+	comparison.Identical = len(comparison.Differences) == 0
+
+	return json.Marshal(comparison)
+}
 
 //=================================================================================================================================
-//	 update_colour
+//	 get_diamond_passport - Gathers the diamond`s details, certification, ownership chain and inspections into a single
+//							versioned document. Only the owner or the Miner can see it as it includes the ownership chain.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_colour(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) get_diamond_passport(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
 
-	
-	if		v.Owner				== caller		{
-			
-					v.Colour = new_value
-	
-	} else {
-															return nil, errors.New("Permission denied")
+	if 		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_diamond_passport")
 	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("update_colour: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
-}
 
+	passport := Diamond_Passport{
+		PassportVersion: PASSPORT_VERSION,
+		AssetID:         v.AssetID,
+		Details:         Passport_Details{Diamondat: v.Diamondat, Colour: v.Colour, Cut: v.Cut, Clarity: v.Clarity, Polish: v.Polish, Symmetry: v.Symmetry, Fluorescence: v.Fluorescence, Origin: v.Origin, JewelleryType: v.JewelleryType, Status: status_labels[v.Status]},
+		Certification:   Passport_Cert{GIACert: v.GIACert, KPCert: v.KPCertNumber, ImageHashes: v.ImageHashes},
+		Provenance:      v.OwnershipHistory,
+		Inspections:     v.InspectionHistory,
+	}
 
+	if passport.Certification.ImageHashes == nil { passport.Certification.ImageHashes = []string{} }
+	if passport.Provenance                == nil { passport.Provenance                = []Ownership_Record{} }
+	if passport.Inspections               == nil { passport.Inspections               = []Inspection_Record{} }
 
+	return json.Marshal(passport)
+}
 
 //=================================================================================================================================
-//	 update_clarity
+//	 get_diamond_qr_payload - Builds the signed QR payload for the diamond. The digest covers only the public details of
+//							  the stone, not its owner or history. The signature shows the payload was issued by this
+//							  chaincode. Only those who can see the diamond can fetch its payload.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_clarity(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
-	
-	if 		v.Owner				== caller		{
-			
-					v.Clarity = new_value
-	} else {
-	
-															return nil, errors.New("Permission denied")
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("UPDATE_CLARITY: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+func (t *SimpleChaincode) get_diamond_qr_payload(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if !can_view_asset(v, caller, caller_affiliation) { return nil, permission_error("Permission Denied. get_diamond_qr_payload") }
+
+	payload := QR_Payload{AssetID: v.AssetID, URL: QR_VERIFY_URL_TEMPLATE, Digest: qr_digest(v)}
+
+	signature, err := t.qr_signature(stub, payload)
+
+																				if err != nil { return nil, err }
+
+	payload.Signature = signature
+
+	return json.Marshal(payload)
 }
 
 //=================================================================================================================================
-//	 update_diamondat
+//	 verify_qr_payload - Checks a scanned QR payload. It matches when the signature is this chaincode`s and the digest
+//						 still matches the diamond`s public details. Only whether it matches is returned, so anyone can
+//						 check a payload.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_diamondat(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
-	
-	if 		v.Owner				== caller		{
-			
-					v.Diamondat = new_value
-	} else {
-	
-															return nil, errors.New("Permission denied")
-	
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("UPDATE_DiamondAT: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+func (t *SimpleChaincode) verify_qr_payload(stub  shim.ChaincodeStubInterface, blob string) Attestation_Result {
+
+	var payload QR_Payload
+
+	err := json.Unmarshal([]byte(blob), &payload)
+
+																				if err != nil { return Attestation_Result{Error: "Invalid QR payload JSON"} }
+
+	result := Attestation_Result{AssetID: payload.AssetID}
+
+	v, err := t.retrieve_assetID(stub, payload.AssetID)
+
+																				if err != nil { result.Error = "Error retrieving assetID"; return result }
+
+	signature, err := t.qr_signature(stub, QR_Payload{AssetID: payload.AssetID, URL: payload.URL, Digest: payload.Digest})
+
+																				if err != nil { result.Error = err.Error(); return result }
+
+	result.Match = hmac.Equal([]byte(signature), []byte(payload.Signature)) && payload.Digest == qr_digest(v)
+
+	return result
 }
 
 //=================================================================================================================================
-//	 update_SYMMETRY
+//	 qr_digest - A short SHA-256 of the diamond`s public details, as carried in its QR payload.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_symmetry(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
-	
-	if 		v.Owner				== caller		{
-			
-					v.Symmetry = new_value
-					
-	} else {
-															return nil, errors.New("Permission denied")
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("UPDATE_SYMMETRY: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
-	
-	return nil, nil
-	
+func qr_digest(v Asset) string {
+
+	public := []string{v.AssetID, v.Diamondat, v.Colour, v.Cut, v.Clarity, v.Polish, v.Symmetry, v.Fluorescence, v.GIACert}
+
+	sum := sha256.Sum256([]byte(strings.Join(public, "|")))
+
+	return fmt.Sprintf("%x", sum[:8])
 }
 
 //=================================================================================================================================
-//	 update_POLISH
+//	 qr_signature - Signs the fields of the QR payload passed, leaving out its signature, with a short HMAC-SHA256 under
+//					the stored signing key. Payloads can`t be signed or checked until the Miner has set a key.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_polish(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) qr_signature(stub  shim.ChaincodeStubInterface, payload QR_Payload) (string, error) {
 
-	if		v.Owner				== caller		{
-			v.Polish=new_value
-					
-	} else {
-		return nil, errors.New("Permission denied")
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, errors.New("SCRAP_assetsrror saving changes") }
-	
-	return nil, nil
-	
+	key, err := stub.GetState("qr_signing_key")
+
+																				if err != nil { return "", errors.New("Unable to get QR signing key") }
+																				if key == nil { return "", invalid_error("QR payloads can`t be signed until a signing key is set") }
+
+	mac := hmac.New(sha256.New, key)
+
+	mac.Write([]byte(payload.AssetID + "|" + payload.URL + "|" + payload.Digest))
+
+	return fmt.Sprintf("%x", mac.Sum(nil)[:16]), nil
 }
+
 //=================================================================================================================================
-//	 update_date
+//	 set_qr_signing_key - Stores the key QR payloads are signed with. No query returns the key. Changing it invalidates
+//						  every QR code already issued. Only the Miner can set it.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_date(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) set_qr_signing_key(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, key string) ([]byte, error) {
 
-	if		v.Owner				== caller		{
-			v.Date=new_value
-					
-	} else {
-		return nil, errors.New("Permission denied")
+	if caller_affiliation != MINER {
+																				return nil, permission_error("Permission denied. set_qr_signing_key")
 	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, errors.New("SCRAP_assetsrror saving changes") }
-	
+
+	if len(key) < 32 {
+																				return nil, invalid_error("Invalid QR signing key, it must be at least 32 characters")
+	}
+
+	err := stub.PutState("qr_signing_key", []byte(key))
+
+																				if err != nil { fmt.Printf("SET_QR_SIGNING_KEY: Error storing signing key: %s", err); return nil, errors.New("Error storing QR signing key") }
+
 	return nil, nil
-	
 }
+
 //=================================================================================================================================
-//	 update_timestamp 
+//	 get_provenance_score - Returns the provenance score of the diamond. Only those who can see the diamond can score it.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_timestamp(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) get_provenance_score(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
 
-	if		v.Owner				== caller		{
-			v.Date=new_value
-					
-	} else {
-		return nil, errors.New("Permission denied")
-	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, errors.New("SCRAP_assetsrror saving changes") }
-	
-	return nil, nil
-	
+	if !can_view_asset(v, caller, caller_affiliation) { return nil, permission_error("Permission Denied. get_provenance_score") }
+
+	return json.Marshal(provenance_score(v))
 }
 
 //=================================================================================================================================
-//	 update_jewellerytype
+//	 get_grade_distribution - Counts how many diamonds hold each clarity, colour and cut grade. Diamonds without a grade
+//							  for a field are left out of that field`s counts. Only the Miner can see this.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_jewellerytype(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) get_grade_distribution(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
 
-	if		v.Owner				== caller		{
-			v.JewelleryType=new_value
-					
-	} else {
-		return nil, errors.New("Permission denied")
+	if 		caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_grade_distribution")
 	}
-	
-	_, err := t.save_changes(stub, v)
-	
-															if err != nil { fmt.Printf("SCRAP_assets: Error saving changes: %s", err); return nil, errors.New("SCRAP_assetsrror saving changes") }
-	
-	return nil, nil
-	
-}
 
+	assetIDs, err := t.retrieve_asset_ids(stub)
 
+																				if err != nil { return nil, err }
+
+	distribution := map[string]map[string]int{"clarity": {}, "colour": {}, "cut": {}}
+
+	for _, assetID := range assetIDs.AssetIDs {
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+		if err != nil { return nil, errors.New("Failed to retrieve AssetID") }
+
+		for field, counts := range distribution {
+			grade := grade_value(v, field)
+
+			if !is_undefined(grade) { counts[grade]++ }
+		}
+	}
+
+	return json.Marshal(distribution)
+}
 
 //=================================================================================================================================
-//	 Read Functions
-//=================================================================================================================================
-//	 get_asset_details
+//	 get_parcel_summary - Totals the carats of the diamonds listed and works out the share of that weight held by each
+//						  colour and clarity grade. Diamonds without a grade for a field are left out of that field`s
+//						  shares. The caller must be able to see every diamond listed.
 //=================================================================================================================================
-func (t *SimpleChaincode) get_asset_details(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
-	
-	bytes, err := json.Marshal(v)
-	
-																if err != nil { return nil, errors.New("GET_ASSET_DETAILS: Invalid asset object") }
-																
-	if 		v.Owner				== caller		||
-			caller_affiliation	== MINER	{
-			
-					return bytes, nil		
-	} else {
-																return nil, errors.New("Permission Denied.get_asset_details")	
+func (t *SimpleChaincode) get_parcel_summary(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string, ids_json string) ([]byte, error) {
+
+	var assetIDs []string
+
+	err := json.Unmarshal([]byte(ids_json), &assetIDs)
+
+																				if err != nil || len(assetIDs) == 0 { return nil, invalid_error("Invalid parcel, expected a JSON array of assetIDs") }
+
+	summary := Parcel_Summary{Colour: map[string]float64{}, Clarity: map[string]float64{}}
+
+	seen := make(map[string]bool)
+
+	for _, assetID := range assetIDs {
+
+		if seen[assetID] { return nil, invalid_error("Invalid parcel, " + assetID + " is listed more than once") }
+
+		seen[assetID] = true
+
+		v, err := t.retrieve_assetID(stub, assetID)
+
+																				if err != nil { return nil, wrap_error("Error retrieving assetID: ", err) }
+
+		if !can_view_asset(v, caller, caller_affiliation) { return nil, permission_error("Permission Denied. get_parcel_summary, " + assetID) }
+
+		summary.Diamonds++
+		summary.TotalCarats += v.Carat
+
+		if !is_undefined(v.Colour)  { summary.Colour[v.Colour]   += v.Carat }
+		if !is_undefined(v.Clarity) { summary.Clarity[v.Clarity] += v.Carat }
+	}
+
+	if summary.TotalCarats > 0 {												// Turn the weight per grade into a share of the parcel
+		for grade, carats := range summary.Colour  { summary.Colour[grade]  = carats / summary.TotalCarats }
+		for grade, carats := range summary.Clarity { summary.Clarity[grade] = carats / summary.TotalCarats }
 	}
 
+	return json.Marshal(summary)
 }
 
 //=================================================================================================================================
-//	 get__assets
+//	 get_value_trend - Returns the diamond`s price history with the change from each price to the one before it and the
+//					   percentage change from the first price to the last. Only the owner or the Miner can see this.
 //=================================================================================================================================
+func (t *SimpleChaincode) get_value_trend(stub  shim.ChaincodeStubInterface, v Asset, caller string, caller_affiliation string) ([]byte, error) {
+
+	if 		v.Owner				!= caller		&&
+			caller_affiliation	!= MINER		{
+																				return nil, permission_error("Permission Denied. get_value_trend")
+	}
 
-func (t *SimpleChaincode) get_assets(stub  shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+	trend := Value_Trend{AssetID: v.AssetID, Points: []Trend_Point{}}
 
-	bytes, err := stub.GetState("assetIDs")
-		
-																			if err != nil { return nil, errors.New("Unable to get assetIDs") }
-																	
-	var assetIDs AssetID_Holder
-	
-	err = json.Unmarshal(bytes, &assetIDs)						
-	
-																			if err != nil {	return nil, errors.New("Corrupt AssetID_Holder") }
-	
-	result := "["
-	
-	var temp []byte
-	var v Asset
-	
-	for _, assetID := range assetIDs.AssetIDs {
-		
-		v, err = t.retrieve_assetID(stub, assetID)
-		
-		if err != nil {return nil, errors.New("Failed to retrieve AssetID")}
-		
-		temp, err = t.get_asset_details(stub, d, caller, caller_affiliation)
-		
-		if err == nil {
-			result += string(temp) + ","	
-		}
+	for i, record := range v.PriceHistory {
+
+		point := Trend_Point{Price: record.Price, Timestamp: record.Timestamp}
+
+		if i > 0 { point.Delta = record.Price - v.PriceHistory[i-1].Price }
+
+		trend.Points = append(trend.Points, point)
 	}
-	
-	if len(result) == 1 {
-		result = "[]"
-	} else {
-		result = result[:len(result)-1] + "]"
+
+	if len(v.PriceHistory) > 1 && v.PriceHistory[0].Price != 0 {
+		first := v.PriceHistory[0].Price
+		last  := v.PriceHistory[len(v.PriceHistory)-1].Price
+		trend.PercentChange = (last - first) / first * 100
 	}
-	
-	return []byte(result), nil
+
+	return json.Marshal(trend)
 }
 
 //=================================================================================================================================
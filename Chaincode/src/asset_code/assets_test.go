@@ -0,0 +1,1323 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+//==============================================================================================================================
+//	 test_stub - The MockStub shipped with Fabric 0.6 returns nothing for certificate attributes or the transaction time,
+//				 so the caller and the clock are supplied here. The timestamp type lives in Fabric`s own vendor tree and
+//				 can`t be named from this package, so it is carried as a type parameter. Writes to keys starting with
+//				 fail_put fail, to stand in for a ledger error.
+//==============================================================================================================================
+type test_stub[T any] struct {
+	*shim.MockStub
+	username string
+	role     string
+	now      T
+	fail_put string
+}
+
+func (s *test_stub[T]) ReadCertAttribute(name string) ([]byte, error) {
+
+	if 		   name == "username" { return []byte(s.username), nil
+	} else if  name == "role"     { return []byte(s.role), nil
+	}
+
+	return nil, nil
+}
+
+func (s *test_stub[T]) GetTxTimestamp() (T, error) { return s.now, nil }
+
+func (s *test_stub[T]) PutState(key string, value []byte) error {
+
+	if s.fail_put != "" && strings.HasPrefix(key, s.fail_put) { return errors.New("PutState failed for " + key) }
+
+	return s.MockStub.PutState(key, value)
+}
+
+func new_test_stub[T any](mock *shim.MockStub, now T) *test_stub[T] {
+
+	return &test_stub[T]{MockStub: mock, now: now}
+}
+
+//==============================================================================================================================
+//	 test_ledger - A freshly initialised chaincode with helpers to call it as a given participant.
+//==============================================================================================================================
+type test_ledger struct {
+	t     *testing.T
+	cc    *SimpleChaincode
+	mock  *shim.MockStub
+	stub  shim.ChaincodeStubInterface
+	as    func(username string, role string)
+	fail  func(prefix string)
+	wait  func(seconds int64)
+	tx    int
+}
+
+func new_test_ledger(t *testing.T) *test_ledger {
+
+	cc   := new(SimpleChaincode)
+	mock := shim.NewMockStub("assets", cc)
+
+	now := util.CreateUtcTimestamp()
+	now.Seconds = 1700000000												// Fixed so the records written are the same on every run
+	now.Nanos   = 0
+
+	stub := new_test_stub(mock, now)
+
+	l := &test_ledger{t: t, cc: cc, mock: mock, stub: stub}
+
+	l.as   = func(username string, role string) { stub.username = username; stub.role = role }
+	l.fail = func(prefix string) { stub.fail_put = prefix }
+	l.wait = func(seconds int64) { now.Seconds += seconds }
+
+	mock.MockTransactionStart("init")
+	_, err := cc.Init(stub, "init", []string{})
+	mock.MockTransactionEnd("init")
+
+	if err != nil { t.Fatalf("Init failed: %s", err) }
+
+	return l
+}
+
+func (l *test_ledger) invoke(function string, args ...string) ([]byte, error) {
+
+	l.tx++
+
+	txid := "tx" + strconv.Itoa(l.tx)
+
+	l.mock.MockTransactionStart(txid)
+	defer l.mock.MockTransactionEnd(txid)
+
+	return l.cc.Invoke(l.stub, function, args)
+}
+
+func (l *test_ledger) query(function string, args ...string) ([]byte, error) {
+
+	return l.cc.Query(l.stub, function, args)
+}
+
+//	must_invoke - Invokes and fails the test on any error.
+func (l *test_ledger) must_invoke(function string, args ...string) []byte {
+
+	l.t.Helper()
+
+	result, err := l.invoke(function, args...)
+
+	if err != nil { l.t.Fatalf("%s %v failed: %s", function, args, err) }
+
+	return result
+}
+
+//	expect_code - Invokes and fails the test unless the call fails with the error code passed.
+func (l *test_ledger) expect_code(code int, function string, args ...string) string {
+
+	l.t.Helper()
+
+	_, err := l.invoke(function, args...)
+
+	if err == nil { l.t.Fatalf("%s %v succeeded, expected error %d", function, args, code) }
+
+	var coded Coded_Error
+
+	if json.Unmarshal([]byte(err.Error()), &coded) != nil { l.t.Fatalf("%s %v returned an uncoded error: %s", function, args, err) }
+
+	if coded.Code != code { l.t.Fatalf("%s %v returned %d (%s), expected %d", function, args, coded.Code, coded.Message, code) }
+
+	return coded.Message
+}
+
+//	asset - Reads a diamond straight from the ledger.
+func (l *test_ledger) asset(assetID string) Asset {
+
+	l.t.Helper()
+
+	v, err := l.cc.retrieve_assetID(l.stub, assetID)
+
+	if err != nil { l.t.Fatalf("Retrieving %s failed: %s", assetID, err) }
+
+	return v
+}
+
+//	create - Creates a diamond as the miner alice.
+func (l *test_ledger) create(assetID string) {
+
+	l.t.Helper()
+
+	l.as("alice", MINER)
+	l.must_invoke("create_asset", assetID)
+}
+
+//	to_distributor - Creates a diamond and hands it to the distributor dave with its Diamondat assigned, ready for grading.
+func (l *test_ledger) to_distributor(assetID string, diamondat string) {
+
+	l.t.Helper()
+
+	l.create(assetID)
+	l.must_invoke("miner_to_distributor", "dave", assetID)
+
+	l.as("dave", DISTRIBUTOR)
+	l.must_invoke("update_diamondat", diamondat, assetID)
+}
+
+//==============================================================================================================================
+
+//==============================================================================================================================
+//	 Grading
+//==============================================================================================================================
+func TestGradeVocabularyRejection(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+
+	message := l.expect_code(ERR_VALIDATION, "update_colour", "D", "AB1234567")
+
+	if !strings.Contains(message, "Diamondat must be assigned") { t.Fatalf("Unexpected error %s", message) }
+
+	l.must_invoke("update_diamondat", "123456789012345", "AB1234567")
+
+	l.expect_code(ERR_VALIDATION, "update_colour", "ZZ", "AB1234567")
+	l.expect_code(ERR_VALIDATION, "update_cut", "Superb", "AB1234567")
+	l.must_invoke("update_colour", "F", "AB1234567")
+
+	l.as("alice", MINER)
+	l.must_invoke("set_grade_vocabulary", "colour", `["D","E"]`)
+	l.expect_code(ERR_VALIDATION, "set_grade_vocabulary", "colour", `[]`)
+	l.expect_code(ERR_VALIDATION, "set_grade_vocabulary", "sparkle", `["A"]`)
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_VALIDATION, "update_colour", "F", "AB1234567")
+	l.must_invoke("update_colour", "E", "AB1234567")
+
+	v := l.asset("AB1234567")
+
+	if v.Colour != "E" { t.Fatalf("Expected colour E, got %s", v.Colour) }
+	if len(v.GradingHistory) != 2 { t.Fatalf("Expected two grading changes, got %+v", v.GradingHistory) }
+}
+
+func TestGradeVocabularyNeedsTheMiner(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "set_grade_vocabulary", "colour", `["D"]`)
+}
+
+func TestGradeVocabularyAcceptsNewClarity(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.to_distributor("AB1234567", "123456789012345")
+	l.expect_code(ERR_VALIDATION, "update_clarity", "SI3", "AB1234567")
+
+	l.as("alice", MINER)
+	l.must_invoke("set_grade_vocabulary", "clarity", `["FL","IF","VVS1","VVS2","VS1","VS2","SI1","SI2","SI3","I1","I2","I3"]`)
+
+	l.as("dave", DISTRIBUTOR)
+	l.must_invoke("update_clarity", "SI3", "AB1234567")
+
+	if l.asset("AB1234567").Clarity != "SI3" { t.Fatal("Expected the newly added clarity grade to be accepted") }
+}
+
+func TestInspectionNormalisesGrades(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.to_distributor("AB1234567", "123456789012345")
+	l.must_invoke("update_colour", "F", "AB1234567")
+
+	l.as("ivan", INSPECTOR)
+	result := l.must_invoke("record_inspection", "AB1234567", `{"colour":" F ","cut":"undefined"}`)
+
+	var inspection Inspection_Record
+
+	if err := json.Unmarshal(result, &inspection); err != nil { t.Fatal(err) }
+
+	if !inspection.Match || len(inspection.Mismatches) != 0 { t.Fatalf("Expected a match, got %+v", inspection) }
+
+	result = l.must_invoke("record_inspection", "AB1234567", `{"colour":"G"}`)
+
+	if err := json.Unmarshal(result, &inspection); err != nil { t.Fatal(err) }
+
+	if inspection.Match || len(inspection.Mismatches) != 1 || inspection.Mismatches[0] != "colour" { t.Fatalf("Expected a colour mismatch, got %+v", inspection) }
+}
+
+func TestDiamondatKeepsLeadingZeros(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_VALIDATION, "update_diamondat", "00012345678901", "AB1234567")		// 14 digits
+	l.expect_code(ERR_VALIDATION, "update_diamondat", "00012345678901X", "AB1234567")
+	l.must_invoke("update_diamondat", "000123456789012", "AB1234567")
+
+	if v := l.asset("AB1234567"); v.Diamondat != "000123456789012" { t.Fatalf("Expected the leading zeros to be kept, got %s", v.Diamondat) }
+
+	if string(l.mock.State[DIAMONDAT_INDEX_PREFIX + "000123456789012"]) != "AB1234567" { t.Fatal("Expected the Diamondat index to use the full identifier") }
+}
+
+//==============================================================================================================================
+//	 Corrupt records
+//==============================================================================================================================
+func TestOutOfRangeStatusIsReportedAsCorrupt(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	for _, status := range []string{"99", "-1"} {
+
+		l.mock.State["AB1234567"] = []byte(`{"assetID":"AB1234567","owner":"alice","status":` + status + `}`)
+
+		_, err := l.cc.retrieve_assetID(l.stub, "AB1234567")
+
+		if err == nil || !strings.Contains(err.Error(), "Corrupt asset record, status " + status) { t.Fatalf("Expected status %s to be reported as corrupt, got %v", status, err) }
+	}
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_INTERNAL, "update_location", "vault", "AB1234567")
+}
+
+func TestFluorescenceGrading(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.to_distributor("AB1234567", "123456789012345")
+
+	l.expect_code(ERR_VALIDATION, "update_fluorescence", "Glowing", "AB1234567")
+	l.must_invoke("update_fluorescence", " Faint ", "AB1234567")						// Graded like the others, not only while with the cutter
+
+	l.as("erin", DEALERSHIP)
+	l.expect_code(ERR_PERMISSION, "update_fluorescence", "None", "AB1234567")
+
+	v := l.asset("AB1234567")
+
+	if v.Fluorescence != "Faint" { t.Fatalf("Expected fluorescence Faint, got %q", v.Fluorescence) }
+	if len(v.GradingHistory) != 1 || v.GradingHistory[0].Field != "fluorescence" { t.Fatalf("Unexpected grading history %+v", v.GradingHistory) }
+
+	result, err := l.query("get_asset_details", "AB1234567")
+
+	if err == nil { t.Fatalf("Expected a caller who doesn`t own the diamond to be refused, got %s", result) }
+
+	l.as("dave", DISTRIBUTOR)
+	result, err = l.query("get_asset_details", "AB1234567")
+
+	if err != nil || !strings.Contains(string(result), `"fluorescence":"Faint"`) { t.Fatalf("Expected fluorescence in the details, got %s %v", result, err) }
+}
+
+//==============================================================================================================================
+//	 Creation
+//==============================================================================================================================
+func TestCreateAssetStartsWithTheMiner(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	v := l.asset("AB1234567")
+
+	if v.Owner != "alice" || v.Status != STATE_MINING || v.Scrapped { t.Fatalf("Unexpected new diamond %+v", v) }
+	if v.SchemaVersion != SCHEMA_VERSION || v.PaymentStatus != PAYMENT_UNPAID { t.Fatalf("Unexpected new diamond %+v", v) }
+	if len(v.OwnershipHistory) != 1 || v.OwnershipHistory[0].Owner != "alice" { t.Fatalf("Unexpected ownership history %+v", v.OwnershipHistory) }
+
+	l.expect_code(ERR_VALIDATION, "create_asset", "AB1234567")
+}
+
+func TestCreateAssetRejectsInjectedFields(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "create_asset", `AB1234567","x":"`)
+	l.expect_code(ERR_VALIDATION, "create_asset", "AB12345678")
+	l.expect_code(ERR_VALIDATION, "create_asset", "A_1234567")
+
+	l.as(`alice","scrapped":true,"x":"`, MINER)
+	l.must_invoke("create_asset", "CD1234567")
+
+	v := l.asset("CD1234567")
+
+	if v.Scrapped || v.Owner != `alice","scrapped":true,"x":"` { t.Fatalf("Caller name leaked into the record %+v", v) }
+}
+
+func TestCreateAssetNeedsTheMiner(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "create_asset", "AB1234567")
+	l.expect_code(ERR_PERMISSION, "create_asset", "not-an-id")						// Refused before the request is looked at
+
+	l.create("AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "create_asset", "AB1234567")						// Doesn`t reveal that the assetID is taken
+}
+
+func TestCreateAssetIndexFailureLeavesNoDiamond(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+	l.fail("assetIDs")
+	l.expect_code(ERR_INTERNAL, "create_asset", "AB1234567")
+
+	if _, ok := l.mock.State["AB1234567"]; ok { t.Fatal("Expected no diamond record when the index write fails") }
+
+	l.fail("")
+	l.must_invoke("create_asset", "AB1234567")
+
+	assets, err := l.query("get_assets")
+
+	if err != nil || !strings.Contains(string(assets), `"assetID":"AB1234567"`) { t.Fatalf("Expected the diamond to be listed once created, got %s %v", assets, err) }
+}
+
+//==============================================================================================================================
+//	 Errors
+//==============================================================================================================================
+func TestErrorCodes(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_NOT_FOUND, "update_location", "vault", "ZZ0000001")
+	l.expect_code(ERR_VALIDATION, "no_such_function")
+	l.expect_code(ERR_VALIDATION, "create_asset")
+
+	l.as("", MINER)
+	l.expect_code(ERR_PERMISSION, "create_asset", "AB1234567")
+
+	l.as("zed", "wizard")
+	l.expect_code(ERR_PERMISSION, "create_asset", "AB1234567")
+
+	l.create("AB1234567")
+
+	l.as("mallory", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "miner_to_distributor", "dave", "AB1234567")
+
+	if error_code(errors.New("Error storing asset record")) != ERR_INTERNAL { t.Fatal("Expected plain errors to be internal") }
+	if error_code(wrap_error("Error retrieving assetID: ", permission_error("Permission denied"))) != ERR_PERMISSION { t.Fatal("Expected wrap_error to keep the code") }
+}
+
+func TestMissingArgumentsAreRejected(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	l.expect_code(ERR_VALIDATION, "update_colour", "D")
+	l.expect_code(ERR_VALIDATION, "miner_to_distributor", "dave")
+	l.expect_code(ERR_VALIDATION, "update_location", "vault", "AB1234567", "extra")
+	l.expect_code(ERR_VALIDATION, "update_location", "vault", "")
+
+	if _, err := l.query("get_ecert"); err == nil { t.Fatal("Expected get_ecert without a name to fail") }
+	if _, err := l.query("check_unique_assetID"); err == nil { t.Fatal("Expected check_unique_assetID without an assetID to fail") }
+}
+
+//==============================================================================================================================
+//	 Asset index
+//==============================================================================================================================
+func TestImportAssetIDs(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "import_asset_ids", `["AB1234567"]`)
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_NOT_FOUND, "import_asset_ids", `["ZZ0000001"]`)
+
+	l.mock.State["CD1234567"] = []byte(`{"assetID":"CD1234567","owner":"alice","status":0}`)
+	l.must_invoke("import_asset_ids", `["CD1234567","CD1234567","AB1234567"]`)
+
+	ids, err := l.cc.retrieve_asset_ids(l.stub)
+
+	if err != nil || len(ids.AssetIDs) != 2 { t.Fatalf("Expected two assetIDs, got %+v %v", ids, err) }
+
+	l.mock.State["EF1234567"] = []byte(`{"assetID":"EF1234567","owner":"alice","status":0}`)
+	l.must_invoke("set_config", `{"maxAssets":2}`)
+	l.expect_code(ERR_VALIDATION, "import_asset_ids", `["EF1234567"]`)
+}
+
+func TestCreateAssetRespectsMaxAssets(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+	l.must_invoke("set_config", `{"maxAssets":1}`)
+
+	l.create("AB1234567")
+	l.expect_code(ERR_VALIDATION, "create_asset", "CD1234567")
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "set_config", `{"maxAssets":2}`)
+
+	l.as("alice", MINER)
+	l.must_invoke("set_config", `{"maxAssets":2}`)
+	l.must_invoke("create_asset", "CD1234567")
+	l.expect_code(ERR_VALIDATION, "create_asset", "EF1234567")
+}
+
+func TestCreateRateLimitPerWindow(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+	l.must_invoke("set_config", `{"createLimit":2,"createWindow":3600}`)
+
+	l.create("AB1234567")
+	l.create("CD1234567")
+
+	message := l.expect_code(ERR_VALIDATION, "create_asset", "EF1234567")
+
+	if !strings.Contains(message, "limit of 2") { t.Fatalf("Expected the create limit to be reported, got %s", message) }
+
+	l.as("bob", MINER)
+	l.must_invoke("create_asset", "EF1234567")									// Counted per miner
+
+	l.wait(3600)																// The next window starts from zero
+	l.create("GH1234567")
+	l.create("IJ1234567")
+	l.expect_code(ERR_VALIDATION, "create_asset", "KL1234567")
+}
+
+//==============================================================================================================================
+//	 Jewellery
+//==============================================================================================================================
+func TestScrapJewelleryScrapsItsDiamonds(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.create("CD1234567")
+	l.must_invoke("admin_transfer", "AB1234567", "jill", JEWELLERYMAKER, "setting")
+	l.must_invoke("admin_transfer", "CD1234567", "jill", JEWELLERYMAKER, "setting")
+
+	l.as("jill", JEWELLERYMAKER)
+	l.must_invoke("create_jewellery", "R1", `["AB1234567","CD1234567"]`)
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "scrap_jewellery", "R1")
+
+	l.as("jill", JEWELLERYMAKER)
+	l.expect_code(ERR_NOT_FOUND, "scrap_jewellery", "R2")
+	l.must_invoke("scrap_jewellery", "R1")
+
+	for _, assetID := range []string{"AB1234567", "CD1234567"} {
+
+		v := l.asset(assetID)
+
+		if !v.Scrapped || v.ScrapReason != "Jewellery R1 scrapped" { t.Fatalf("Expected %s to be scrapped with the jewellery, got %+v", assetID, v) }
+	}
+
+	l.expect_code(ERR_VALIDATION, "scrap_jewellery", "R1")
+}
+
+//==============================================================================================================================
+//	 Transfers
+//==============================================================================================================================
+func TestTransferWithDocumentSavesTheHashOnce(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	hash := strings.Repeat("AB", 32)
+
+	l.expect_code(ERR_VALIDATION, "transfer_with_document", "AB1234567", "dave", "miner_to_distributor", "not-a-hash")
+	l.must_invoke("transfer_with_document", "AB1234567", "dave", "miner_to_distributor", hash)
+
+	v := l.asset("AB1234567")
+
+	if len(v.OwnershipHistory) != 2 { t.Fatalf("Expected two ownership entries, got %+v", v.OwnershipHistory) }
+	if v.OwnershipHistory[1].DocumentHash != strings.ToLower(hash) { t.Fatalf("Expected the document hash on the new entry, got %+v", v.OwnershipHistory[1]) }
+	if v.OwnershipHistory[0].DocumentHash != "" { t.Fatal("Expected the creation entry to carry no document hash") }
+}
+
+func TestTransferEdges(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_PERMISSION, "distributor_to_dealership", "erin", "AB1234567")	// Wrong edge for the diamond`s status
+	l.expect_code(ERR_VALIDATION, "transfer", "AB1234567", "dave", "miner_to_nowhere")
+
+	l.as("mallory", MINER)
+	l.expect_code(ERR_PERMISSION, "miner_to_distributor", "dave", "AB1234567")		// Not the owner
+
+	l.as("alice", MINER)
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+
+	v := l.asset("AB1234567")
+
+	if v.Owner != "dave" || v.Status != STATE_DISTRIBUTING { t.Fatalf("Unexpected diamond after transfer %+v", v) }
+	if len(v.OwnershipHistory) != 2 || v.OwnershipHistory[1].From != "alice" { t.Fatalf("Unexpected history %+v", v.OwnershipHistory) }
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "miner_to_distributor", "dave", "AB1234567")
+}
+
+func TestKimberleyProcessCertificate(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("update_origin", "Jwaneng", "AB1234567")
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+
+	message := l.expect_code(ERR_VALIDATION, "distributor_to_dealership", "erin", "AB1234567")
+
+	if !strings.Contains(message, "Kimberley Process") { t.Fatalf("Expected the KP certificate to be required, got %s", message) }
+
+	l.expect_code(ERR_PERMISSION, "set_kp_cert", "AB1234567", "BW12345678")
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "set_kp_cert", "AB1234567", " ")
+	l.expect_code(ERR_VALIDATION, "set_kp_cert", "AB1234567", "")
+
+	l.must_invoke("set_kp_cert", "AB1234567", " KP-2019/00123 ")				// Numbers are kept as issued, only trimmed
+
+	if l.asset("AB1234567").KPCertNumber != "KP-2019/00123" { t.Fatalf("Unexpected certificate %s", l.asset("AB1234567").KPCertNumber) }
+
+	l.must_invoke("set_kp_cert", "AB1234567", "BW12345678")					// The Miner can still certify a stone it no longer holds
+
+	l.as("dave", DISTRIBUTOR)
+	l.must_invoke("distributor_to_dealership", "erin", "AB1234567")
+
+	if l.asset("AB1234567").Status != STATE_INTER_DEALING { t.Fatal("Expected the diamond to be with the dealership") }
+}
+
+func TestGenericTransferMatchesNamedTransfer(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.create("CD1234567")
+
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+	l.must_invoke("transfer", "CD1234567", "dave", "miner_to_distributor")
+
+	named, generic := l.asset("AB1234567"), l.asset("CD1234567")
+
+	if named.Owner != generic.Owner || named.Status != generic.Status { t.Fatalf("Expected the same transfer, got %+v and %+v", named, generic) }
+	if len(named.OwnershipHistory) != len(generic.OwnershipHistory) || named.OwnershipHistory[1] != generic.OwnershipHistory[1] { t.Fatalf("Expected the same history, got %+v and %+v", named.OwnershipHistory, generic.OwnershipHistory) }
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "transfer", "CD1234567", "dave", "miner_to_distributor")
+}
+
+func TestTransferToCustomerNeedsConfirmedPayment(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.to_distributor("AB1234567", "123456789012345")
+
+	l.must_invoke("distributor_to_dealership", "erin", "AB1234567")
+	l.as("erin", DEALERSHIP)
+	l.must_invoke("dealership_to_buyer", "bob", "AB1234567")
+	l.as("bob", BUYER)
+	l.must_invoke("buyer_to_trader", "tom", "AB1234567")
+	l.as("tom", TRADER)
+	l.must_invoke("trader_to_cutter", "carl", "AB1234567")
+
+	l.as("carl", CUTTER)
+	l.expect_code(ERR_VALIDATION, "cutter_to_jewellery_maker", "jill", "AB1234567")	// Cut, symmetry and polish aren`t graded yet
+	l.must_invoke("update_cut", "Excellent", "AB1234567")
+	l.must_invoke("update_symmetry", "Very Good", "AB1234567")
+	l.must_invoke("update_polish", "Good", "AB1234567")
+	l.must_invoke("cutter_to_jewellery_maker", "jill", "AB1234567")
+
+	l.as("jill", JEWELLERYMAKER)
+	l.must_invoke("update_jewellerytype", "ring", "AB1234567")
+
+	message := l.expect_code(ERR_VALIDATION, "jewellery_maker_to_customer", "cathy", "AB1234567")
+
+	if !strings.Contains(message, "paid") { t.Fatalf("Expected payment to be required, got %s", message) }
+
+	l.expect_code(ERR_PERMISSION, "update_payment_status", "paid", "AB1234567")		// The seller can`t certify its own payment
+	l.must_invoke("update_payment_status", "partial", "AB1234567")
+
+	l.as("alice", MINER)
+	l.must_invoke("update_payment_status", "paid", "AB1234567")
+
+	l.as("jill", JEWELLERYMAKER)
+	l.must_invoke("jewellery_maker_to_customer", "cathy", "AB1234567")
+
+	v := l.asset("AB1234567")
+
+	if v.Owner != "cathy" || v.Status != STATE_PURCHASING { t.Fatalf("Unexpected diamond %+v", v) }
+	if len(v.OwnershipHistory) != 8 { t.Fatalf("Expected eight ownership entries, got %d", len(v.OwnershipHistory)) }
+}
+
+func TestFailedTransferSaveLeavesHistoryUnchanged(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	before := string(l.mock.State["AB1234567"])
+
+	l.fail("AB1234567")
+	l.expect_code(ERR_INTERNAL, "miner_to_distributor", "dave", "AB1234567")
+	l.fail("")
+
+	if string(l.mock.State["AB1234567"]) != before { t.Fatal("Expected the stored diamond to be untouched by the failed transfer") }
+
+	v := l.asset("AB1234567")
+
+	if v.Owner != "alice" || len(v.OwnershipHistory) != 1 { t.Fatalf("Expected no ownership change to be persisted, got %+v", v.OwnershipHistory) }
+
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+
+	if len(l.asset("AB1234567").OwnershipHistory) != 2 { t.Fatal("Expected exactly one new ownership entry once the save succeeds") }
+}
+
+func TestScrappedDiamondCannotMove(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("scrap_asset", "AB1234567")
+
+	if !l.asset("AB1234567").Scrapped { t.Fatal("Expected the diamond to be scrapped") }
+
+	for _, args := range [][]string{
+		{"miner_to_distributor", "dave", "AB1234567"},
+		{"transfer", "AB1234567", "dave", "miner_to_distributor"},
+		{"transfer_with_document", "AB1234567", "dave", "miner_to_distributor", strings.Repeat("ab", 32)},
+		{"admin_transfer", "AB1234567", "dave", DISTRIBUTOR, "court order"},
+	} {
+		message := l.expect_code(ERR_VALIDATION, args[0], args[1:]...)
+
+		if message != "Diamond is scrapped; no further transfers allowed" { t.Fatalf("%s returned %q, expected the scrapped transfer message", args[0], message) }
+	}
+
+	results := batch_results(t, l.must_invoke("batch_transfer", `["AB1234567"]`, "dave", "miner_to_distributor"))
+
+	if results[0].Success || results[0].Error != "Diamond is scrapped; no further transfers allowed" { t.Fatalf("Unexpected batch result %+v", results) }
+
+	l.expect_code(ERR_VALIDATION, "scrap_asset", "AB1234567")
+}
+
+func TestAdminTransfer(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "admin_transfer", "AB1234567", "cathy", CUSTOMER, "court order")
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "admin_transfer", "AB1234567", "cathy", CUSTOMER, " ")
+	l.must_invoke("admin_transfer", "AB1234567", "cathy", CUSTOMER, "court order")
+
+	v := l.asset("AB1234567")
+
+	if v.Owner != "cathy" || v.Status != STATE_PURCHASING { t.Fatalf("Unexpected diamond %+v", v) }
+
+	last := v.OwnershipHistory[len(v.OwnershipHistory)-1]
+
+	if last.AuthorizedBy != "alice" || last.Reason != "court order" { t.Fatalf("Unexpected ownership entry %+v", last) }
+}
+
+//==============================================================================================================================
+//	 Identities
+//==============================================================================================================================
+func TestRefreshRoleReadsTheCurrentEcert(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.mock.State["dave"] = test_ecert(t, "distributor")
+
+	l.as("dave", DISTRIBUTOR)
+
+	if _, err := l.query("refresh_role", "dave"); err == nil { t.Fatal("Expected refresh_role to need the Miner") }
+
+	l.as("alice", MINER)
+
+	role, err := l.query("refresh_role", "dave")
+
+	if err != nil || string(role) != "distributor" { t.Fatalf("Expected distributor, got %s %v", role, err) }
+
+	l.mock.State["dave"] = test_ecert(t, "Dealership")								// Reissued with a new role
+
+	role, err = l.query("refresh_role", "dave")
+
+	if err != nil || string(role) != "dealership" { t.Fatalf("Expected the new role, got %s %v", role, err) }
+
+	if _, err = l.query("refresh_role", "nobody"); err == nil { t.Fatal("Expected a user without an ecert to be refused") }
+}
+
+//	test_ecert - A self signed PEM certificate carrying the role passed as its organizational unit.
+func test_ecert(t *testing.T, role string) []byte {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil { t.Fatal(err) }
+
+	template := x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test", OrganizationalUnit: []string{role}}}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil { t.Fatal(err) }
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestWhoAmI(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("dave", DISTRIBUTOR)
+
+	result, err := l.query("whoami")
+
+	if err != nil { t.Fatal(err) }
+
+	var identity Caller_Identity
+
+	if err = json.Unmarshal(result, &identity); err != nil { t.Fatal(err) }
+
+	if identity.Username != "dave" || identity.Affiliation != DISTRIBUTOR || identity.Issuer != "" { t.Fatalf("Unexpected identity %+v", identity) }
+}
+
+//==============================================================================================================================
+//	 Write offs
+//==============================================================================================================================
+func TestWriteOffApproval(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("admin_transfer", "AB1234567", "cathy", CUSTOMER, "inheritance")
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "approve_write_off")
+	l.expect_code(ERR_VALIDATION, "approve_write_off", "AB1234567")			// Nothing pending
+
+	l.as("cathy", CUSTOMER)
+	l.expect_code(ERR_VALIDATION, "customer_write_off", "AB1234567", " ")
+	l.must_invoke("customer_write_off", "AB1234567", "lost at sea")
+
+	if !l.asset("AB1234567").WriteOffPending { t.Fatal("Expected a pending write off") }
+
+	l.expect_code(ERR_PERMISSION, "approve_write_off", "AB1234567")
+
+	l.as("alice", MINER)
+	l.must_invoke("approve_write_off", "AB1234567")
+
+	v := l.asset("AB1234567")
+
+	if !v.Scrapped || v.WriteOffPending || v.Status != STATE_BEING_SCRAPPED { t.Fatalf("Unexpected diamond after approval %+v", v) }
+	if v.ScrapReason != "lost at sea" { t.Fatalf("Expected the write off reason as the scrap reason, got %q", v.ScrapReason) }
+
+	l.expect_code(ERR_VALIDATION, "approve_write_off", "AB1234567")
+}
+
+func TestScrapSettlesPendingWriteOff(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("admin_transfer", "AB1234567", "cathy", CUSTOMER, "inheritance")
+
+	l.as("cathy", CUSTOMER)
+	l.must_invoke("customer_write_off", "AB1234567", "stolen")
+	l.must_invoke("scrap_asset", "AB1234567")
+
+	if l.asset("AB1234567").WriteOffPending { t.Fatal("Expected scrapping to clear the pending write off") }
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "approve_write_off", "AB1234567")
+
+	l.mock.State["CD1234567"] = []byte(`{"assetID":"CD1234567","owner":"cathy","status":8,"scrapped":true,"writeOffPending":true}`)	// Scrapped before scrap_asset cleared the flag
+
+	message := l.expect_code(ERR_VALIDATION, "approve_write_off", "CD1234567")
+
+	if !strings.Contains(message, "scrapped") { t.Fatalf("Expected the scrapped diamond to be refused, got %s", message) }
+}
+
+
+//==============================================================================================================================
+//	 Batches
+//==============================================================================================================================
+func TestBatchFunctionsReturnArrays(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+
+	result := l.must_invoke("bulk_scrap", `[]`, "recall")
+
+	if string(result) != "[]" { t.Fatalf("Expected an empty array, got %s", result) }
+
+	l.create("AB1234567")
+	l.create("CD1234567")
+	l.create("EF1234567")
+	l.must_invoke("set_held", "CD1234567", "true")
+	l.must_invoke("scrap_asset", "EF1234567")
+
+	results := batch_results(t, l.must_invoke("bulk_scrap", `["AB1234567","CD1234567","ZZ0000001","EF1234567"]`, "recall"))
+
+	if len(results) != 4 || !results[0].Success || results[1].Success || results[2].Success || results[3].Success { t.Fatalf("Unexpected results %+v", results) }
+
+	if l.asset("AB1234567").ScrapReason != "recall" { t.Fatal("Expected the recall reason on the scrapped diamond") }
+}
+
+func batch_results(t *testing.T, result []byte) []Batch_Result {
+
+	var results []Batch_Result
+
+	if err := json.Unmarshal(result, &results); err != nil { t.Fatalf("Invalid batch results %s: %s", result, err) }
+
+	return results
+}
+
+//==============================================================================================================================
+//	 QR payloads
+//==============================================================================================================================
+func TestQRPayloadIsSignedAndCompact(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	if _, err := l.query("get_diamond_qr_payload", "AB1234567"); err == nil { t.Fatal("Expected no payload before a signing key is set") }
+
+	key := strings.Repeat("k", 32)
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "set_qr_signing_key", key)
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "set_qr_signing_key", "short")
+	l.must_invoke("set_qr_signing_key", key)
+
+	result, err := l.query("get_diamond_qr_payload", "AB1234567")
+
+	if err != nil { t.Fatal(err) }
+
+	var payload QR_Payload
+
+	if err = json.Unmarshal(result, &payload); err != nil { t.Fatal(err) }
+
+	if payload.AssetID != "AB1234567" || len(payload.Digest) != 16 || len(payload.Signature) != 32 || len(result) > 128 { t.Fatalf("Unexpected QR payload %s", result) }
+
+	if ecert, _ := l.query("get_ecert", "qr_signing_key"); len(ecert) != 0 { t.Fatal("Expected the signing key not to be readable") }
+
+	var verified Attestation_Result
+
+	check, err := l.query("verify_qr_payload", string(result))
+
+	if err = json.Unmarshal(check, &verified); err != nil || !verified.Match { t.Fatalf("Expected the payload to verify, got %s %v", check, err) }
+
+	payload.Signature = strings.Repeat("0", 32)
+	forged, _ := json.Marshal(payload)
+
+	check, err = l.query("verify_qr_payload", string(forged))
+
+	if err = json.Unmarshal(check, &verified); err != nil || verified.Match { t.Fatalf("Expected a forged signature to fail, got %s %v", check, err) }
+
+	l.as("dave", DISTRIBUTOR)
+
+	if _, err = l.query("get_diamond_qr_payload", "AB1234567"); err == nil { t.Fatal("Expected a caller who can`t see the diamond to be refused") }
+	if _, err = l.query("get_provenance_score", "AB1234567"); err == nil { t.Fatal("Expected a caller who can`t see the diamond to be refused a score") }
+}
+
+//==============================================================================================================================
+//	 Listings
+//==============================================================================================================================
+func TestGetAssetsGzipRoundTrip(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.create("CD1234567")
+
+	plain, err := l.query("get_assets")
+
+	if err != nil { t.Fatal(err) }
+
+	compressed, err := l.query("get_assets", "false", "false", "true")
+
+	if err != nil { t.Fatal(err) }
+
+	raw, err := base64.StdEncoding.DecodeString(string(compressed))
+
+	if err != nil { t.Fatalf("Expected base64, got %s: %s", compressed, err) }
+
+	reader, err := gzip.NewReader(bytes.NewReader(raw))
+
+	if err != nil { t.Fatal(err) }
+
+	decompressed, err := io.ReadAll(reader)
+
+	if err != nil { t.Fatal(err) }
+
+	if string(decompressed) != string(plain) { t.Fatalf("Expected the decompressed listing to match, got %s and %s", decompressed, plain) }
+
+	if _, err = l.query("get_assets", "false", "false", "maybe"); err == nil { t.Fatal("Expected an invalid gzip flag to be refused") }
+}
+
+func TestGetAssetsReadsTheOwnerIndex(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.create("CD1234567")
+	l.create("EF1234567")
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+	l.must_invoke("miner_to_distributor", "dave", "CD1234567")
+
+	listed := func() string {
+
+		t.Helper()
+
+		l.as("dave", DISTRIBUTOR)
+
+		result, err := l.query("get_assets")
+
+		if err != nil { t.Fatal(err) }
+
+		var diamonds []Asset
+
+		if err = json.Unmarshal(result, &diamonds); err != nil { t.Fatalf("Expected a JSON array, got %s", result) }
+
+		var ids []string
+
+		for _, v := range diamonds { ids = append(ids, v.AssetID) }
+
+		return strings.Join(ids, ",")
+	}
+
+	if got := listed(); got != "AB1234567,CD1234567" { t.Fatalf("Expected dave`s two diamonds, got %s", got) }
+
+	l.mock.MockTransactionStart("corrupt")
+	l.mock.DelState(owner_index_key("dave", "CD1234567"))
+	l.mock.PutState(owner_index_key("dave", "EF1234567"), []byte("EF1234567"))
+	l.mock.MockTransactionEnd("corrupt")
+
+	if got := listed(); got != "AB1234567" { t.Fatalf("Expected the listing to follow the drifted index without showing alice`s diamond, got %s", got) }
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "rebuild_owner_index")
+
+	l.as("alice", MINER)
+	l.must_invoke("rebuild_owner_index")
+
+	if got := listed(); got != "AB1234567,CD1234567" { t.Fatalf("Expected the rebuilt index to list dave`s two diamonds, got %s", got) }
+
+	if _, ok := l.mock.State[owner_index_key("dave", "EF1234567")]; ok { t.Fatal("Expected the rebuild to drop the stray entry") }
+}
+
+//==============================================================================================================================
+//	 Holds and disputes
+//==============================================================================================================================
+func TestHeldDiamondCannotBeUpdated(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("set_held", "AB1234567", "true")
+
+	l.expect_code(ERR_VALIDATION, "miner_to_distributor", "dave", "AB1234567")
+	l.expect_code(ERR_VALIDATION, "update_location", "vault", "AB1234567")
+	l.expect_code(ERR_VALIDATION, "set_held", "AB1234567")
+
+	l.must_invoke("set_held", "AB1234567", "false")
+	l.must_invoke("update_location", "vault", "AB1234567")
+}
+
+func TestDisputedAndScrappedDiamondsCannotBeUpdated(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+	l.must_invoke("set_disputed", "AB1234567", "true")
+
+	message := l.expect_code(ERR_VALIDATION, "update_location", "vault", "AB1234567")
+
+	if !strings.Contains(message, "disputed") { t.Fatalf("Expected the dispute to be reported, got %s", message) }
+
+	l.must_invoke("set_disputed", "AB1234567", "false")
+	l.must_invoke("update_location", "vault", "AB1234567")
+
+	l.create("CD1234567")
+	l.must_invoke("scrap_asset", "CD1234567")
+
+	message = l.expect_code(ERR_VALIDATION, "update_location", "vault", "CD1234567")
+
+	if !strings.Contains(message, "scrapped") { t.Fatalf("Expected the scrapped diamond to be reported, got %s", message) }
+}
+
+//==============================================================================================================================
+//	 Freeze
+//==============================================================================================================================
+func TestGlobalFreezeBlocksEverythingButMinerAdmin(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	l.as("dave", DISTRIBUTOR)
+	l.expect_code(ERR_PERMISSION, "set_global_freeze", "true", "audit")
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_VALIDATION, "set_global_freeze", "true", " ")
+	l.must_invoke("set_global_freeze", "true", "audit")
+
+	message := l.expect_code(ERR_VALIDATION, "miner_to_distributor", "dave", "AB1234567")
+
+	if !strings.Contains(message, "audit") { t.Fatalf("Expected the freeze reason, got %s", message) }
+
+	l.expect_code(ERR_VALIDATION, "create_asset", "CD1234567")
+	l.expect_code(ERR_VALIDATION, "update_location", "vault", "AB1234567")
+
+	l.must_invoke("set_held", "AB1234567", "true")							// Miner admin functions stay open
+	l.must_invoke("set_held", "AB1234567", "false")
+	l.must_invoke("verify_user", "dave")
+
+	result, err := l.query("get_global_freeze")
+
+	if err != nil || !strings.Contains(string(result), "audit") { t.Fatalf("Unexpected freeze %s %v", result, err) }
+
+	l.must_invoke("set_global_freeze", "false", "")
+	l.must_invoke("miner_to_distributor", "dave", "AB1234567")
+
+	if l.asset("AB1234567").Owner != "dave" { t.Fatal("Transfer after the freeze was lifted didn`t happen") }
+}
+
+//==============================================================================================================================
+//	 Schema migration
+//==============================================================================================================================
+func TestSchemaVersionIsUpgradedOnSave(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+
+	result, err := l.query("get_schema_version")
+
+	if err != nil || !strings.Contains(string(result), `"schemaVersion":` + strconv.Itoa(SCHEMA_VERSION)) { t.Fatalf("Unexpected schema version %s %v", result, err) }
+
+	l.mock.State["AB1234567"] = []byte(`{"assetID":"AB1234567","owner":"alice","status":0,"schemaVersion":1}`)
+
+	l.must_invoke("update_location", "vault", "AB1234567")
+
+	var stored Asset
+
+	if err = json.Unmarshal(l.mock.State["AB1234567"], &stored); err != nil { t.Fatal(err) }
+
+	if stored.SchemaVersion != SCHEMA_VERSION { t.Fatalf("Expected the upgrade to be stored, got version %d", stored.SchemaVersion) }
+}
+
+func TestSchemaMigrationUpgradesOldRecords(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.mock.State["AB1234567"] = []byte(`{"assetID":"AB1234567","owner":"alice","status":1,"colour":" UNDEFINED ","cut":"undefined"}`)
+
+	v := l.asset("AB1234567")
+
+	if v.SchemaVersion != SCHEMA_VERSION { t.Fatalf("Expected schema version %d, got %d", SCHEMA_VERSION, v.SchemaVersion) }
+	if v.PaymentStatus != PAYMENT_UNPAID { t.Fatalf("Expected unpaid, got %s", v.PaymentStatus) }
+	if v.Colour != "UNDEFINED" || v.Cut != "UNDEFINED" { t.Fatalf("Expected normalised fields, got %q %q", v.Colour, v.Cut) }
+	if v.OwnershipHistory == nil || v.StatusHistory == nil { t.Fatal("Expected empty histories rather than nil") }
+}
+
+func TestSchemaMigrationRefusesNewerRecords(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.mock.State["AB1234567"] = []byte(`{"assetID":"AB1234567","owner":"alice","status":0,"schemaVersion":99}`)
+
+	_, err := l.cc.retrieve_assetID(l.stub, "AB1234567")
+
+	if err == nil { t.Fatal("Expected a record from newer code to be refused") }
+
+	_, err = l.cc.save_changes(l.stub, Asset{AssetID: "CD1234567", Owner: "alice", SchemaVersion: SCHEMA_VERSION + 1})
+
+	if err == nil || error_code(err) != ERR_VALIDATION { t.Fatalf("Expected save_changes to refuse a newer schema version as invalid, got %v", err) }
+
+	l.as("alice", MINER)
+	l.expect_code(ERR_INTERNAL, "update_location", "vault", "AB1234567")
+}
+
+func TestLegacyCapitalisedStatusIsRead(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.mock.State["AB1234567"] = []byte(`{"assetID":"AB1234567","owner":"dave","Status":1}`)
+	l.mock.State["CD1234567"] = []byte(`{"assetID":"CD1234567","owner":"erin","status":2,"Status":1}`)
+
+	if v := l.asset("AB1234567"); v.Status != STATE_DISTRIBUTING { t.Fatalf("Expected the legacy key to be read, got status %d", v.Status) }
+	if v := l.asset("CD1234567"); v.Status != STATE_INTER_DEALING { t.Fatalf("Expected the lowercase key to win, got status %d", v.Status) }
+}
+
+//==============================================================================================================================
+//	 Record invariants
+//==============================================================================================================================
+func TestSaveChangesRejectsOwnerHistoryMismatch(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.create("AB1234567")
+
+	v := l.asset("AB1234567")
+	v.Owner = "mallory"														// Owner changed without a matching ownership entry
+
+	l.mock.MockTransactionStart("mismatch")
+	_, err := l.cc.save_changes(l.stub, v)
+	l.mock.MockTransactionEnd("mismatch")
+
+	if err == nil || error_code(err) != ERR_VALIDATION || !strings.Contains(err.Error(), "ownership history") { t.Fatalf("Expected the mismatch to be rejected, got %v", err) }
+
+	if l.asset("AB1234567").Owner != "alice" { t.Fatal("Expected the rejected record not to be stored") }
+}
+
+func TestSaveErrorsKeepTheirCode(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.mock.State["AB1234567"] = []byte(`{"assetID":"AB1234567","owner":"alice","status":0,"diamondat":"12345"}`)		// A Diamondat save_changes won`t accept
+
+	l.as("alice", MINER)
+
+	message := l.expect_code(ERR_VALIDATION, "update_location", "vault", "AB1234567")
+
+	if !strings.HasPrefix(message, "Error saving changes: Invalid Diamondat") { t.Fatalf("Expected the Diamondat problem to come through, got %s", message) }
+
+	l.create("CD1234567")
+	l.fail("CD1234567")
+
+	message = l.expect_code(ERR_INTERNAL, "update_location", "vault", "CD1234567")
+
+	if !strings.HasPrefix(message, "Error saving changes: ") { t.Fatalf("Unexpected message %s", message) }
+}
+
+//==============================================================================================================================
+//	 Snapshots
+//==============================================================================================================================
+func TestSnapshotImport(t *testing.T) {
+
+	source := new_test_ledger(t)
+
+	source.create("AB1234567")
+	source.create("CD1234567")
+
+	source.as("dave", DISTRIBUTOR)
+
+	if _, err := source.query("export_snapshot"); err == nil { t.Fatal("Expected export_snapshot to need the Miner") }
+
+	source.as("alice", MINER)
+
+	snapshot, err := source.query("export_snapshot")
+
+	if err != nil { t.Fatal(err) }
+
+	target := new_test_ledger(t)
+
+	target.as("dave", DISTRIBUTOR)
+	target.expect_code(ERR_PERMISSION, "import_snapshot", string(snapshot))
+
+	target.as("alice", MINER)
+	target.expect_code(ERR_VALIDATION, "import_snapshot", "{")
+
+	results := batch_results(t, target.must_invoke("import_snapshot", string(snapshot)))
+
+	if len(results) != 2 || !results[0].Success || !results[1].Success { t.Fatalf("Unexpected results %+v", results) }
+
+	if target.asset("CD1234567").Owner != "alice" { t.Fatal("Expected the imported diamond") }
+
+	results = batch_results(t, target.must_invoke("import_snapshot", string(snapshot)))
+
+	if results[0].Success || !strings.Contains(results[0].Error, "force") { t.Fatalf("Expected existing diamonds to be kept, got %+v", results) }
+
+	assets, err := target.query("get_assets")
+
+	if err != nil || strings.Count(string(assets), `"assetID"`) != 2 { t.Fatalf("Expected two diamonds in the index, got %s %v", assets, err) }
+}
+
+func TestSnapshotImportForceReleasesOldIndexes(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+
+	diamond := Asset{AssetID: "AB1234567", Owner: "alice", Status: STATE_MINING, GIACert: "1111111111", Diamondat: "123456789012345"}
+
+	l.must_invoke("import_snapshot", snapshot_json(t, diamond))
+
+	if string(l.mock.State[GIA_INDEX_PREFIX + "1111111111"]) != "AB1234567" { t.Fatal("Expected the GIA index entry") }
+
+	diamond.GIACert   = "2222222222"
+	diamond.Diamondat = "999999999999999"
+
+	results := batch_results(t, l.must_invoke("import_snapshot", snapshot_json(t, diamond), "true"))
+
+	if !results[0].Success { t.Fatalf("Expected the forced import to succeed, got %+v", results) }
+
+	if _, ok := l.mock.State[GIA_INDEX_PREFIX + "1111111111"]; ok { t.Fatal("Expected the old GIA index entry to be released") }
+	if _, ok := l.mock.State[DIAMONDAT_INDEX_PREFIX + "123456789012345"]; ok { t.Fatal("Expected the old Diamondat index entry to be released") }
+
+	if string(l.mock.State[GIA_INDEX_PREFIX + "2222222222"]) != "AB1234567" { t.Fatal("Expected the new GIA index entry") }
+	if string(l.mock.State[DIAMONDAT_INDEX_PREFIX + "999999999999999"]) != "AB1234567" { t.Fatal("Expected the new Diamondat index entry") }
+}
+
+func TestSnapshotImportRespectsMaxAssets(t *testing.T) {
+
+	l := new_test_ledger(t)
+
+	l.as("alice", MINER)
+	l.must_invoke("set_config", `{"maxAssets":1}`)
+
+	results := batch_results(t, l.must_invoke("import_snapshot", snapshot_json(t,
+		Asset{AssetID: "AB1234567", Owner: "alice", Status: STATE_MINING},
+		Asset{AssetID: "CD1234567", Owner: "alice", Status: STATE_MINING})))
+
+	if !results[0].Success || results[1].Success { t.Fatalf("Expected only the first diamond to fit, got %+v", results) }
+
+	if _, ok := l.mock.State["CD1234567"]; ok { t.Fatal("Expected the rejected diamond to leave nothing behind") }
+}
+
+func snapshot_json(t *testing.T, diamonds ...Asset) string {
+
+	bytes, err := json.Marshal(Snapshot{Diamonds: diamonds})
+
+	if err != nil { t.Fatal(err) }
+
+	return string(bytes)
+}